@@ -2,51 +2,109 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	// import internal package
 	api "blockbuffer/internal/api"
 	fs "blockbuffer/internal/filesystem"
 	"blockbuffer/internal/io"
 	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
 )
 
 func main() {
-	io.Logf("Watching: %s", io.Info, *opts.WatchDir)
-	io.Logf("Outputting to: %s", io.Info, *opts.OutputDir)
-	io.Logf("Uploading to: %s", io.Info, *opts.UploadDir)
+	if err := fs.UseTranscoder(*opts.Transcoder); err != nil {
+		io.Logf("Failed to select transcoder: %v", io.Fatal, err)
+	}
+	if err := store.SetConcurrency(*opts.MaxConcurrent); err != nil {
+		io.Logf("Invalid concurrency: %v", io.Fatal, err)
+	}
+	if err := store.SetPolicy(types.SchedulePolicy(*opts.Schedule)); err != nil {
+		io.Logf("Failed to select schedule policy: %v", io.Fatal, err)
+	}
 
-	// Ensure output directory exists
-	if _, err := os.Stat(*opts.OutputDir); os.IsNotExist(err) {
-		err := os.MkdirAll(*opts.OutputDir, 0755)
-		if err != nil {
-			io.Logf("Failed to create output directory: %v", io.Fatal, err)
+	hotFolders := types.ListHotFolders()
+	for _, folder := range hotFolders {
+		io.Logf("Watching: %s (%s)", io.Info, folder.WatchDir, folder.Name)
+		io.Logf("Outputting to: %s (%s)", io.Info, folder.OutputDir, folder.Name)
+
+		// Ensure output directory exists
+		if _, err := os.Stat(folder.OutputDir); os.IsNotExist(err) {
+			err := os.MkdirAll(folder.OutputDir, 0755)
+			if err != nil {
+				io.Logf("Failed to create output directory: %v", io.Fatal, err)
+			}
+		}
+
+		// Ensure watch directory exists
+		if _, err := os.Stat(folder.WatchDir); os.IsNotExist(err) {
+			err := os.MkdirAll(folder.WatchDir, 0755)
+			if err != nil {
+				io.Logf("Failed to create watch directory: %v", io.Fatal, err)
+			}
 		}
 	}
+	io.Logf("Uploading to: %s", io.Info, *opts.UploadDir)
 
 	// Ensure upload directory exists
-	if _, err := os.Stat(*opts.WatchDir); os.IsNotExist(err) {
-		err := os.MkdirAll(*opts.WatchDir, 0755)
+
+	if _, err := os.Stat(*opts.UploadDir); os.IsNotExist(err) {
+		err := os.MkdirAll(*opts.UploadDir, 0755)
 		if err != nil {
 			io.Logf("Failed to create upload directory: %v", io.Fatal, err)
 		}
 	}
 
-	if _, err := os.Stat(*opts.UploadDir); os.IsNotExist(err) {
-		err := os.MkdirAll(*opts.UploadDir, 0755)
+	if _, err := os.Stat(*opts.DataDir); os.IsNotExist(err) {
+		err := os.MkdirAll(*opts.DataDir, 0755)
 		if err != nil {
-			io.Logf("Failed to create upload directory: %v", io.Fatal, err)
+			io.Logf("Failed to create data directory: %v", io.Fatal, err)
 		}
 	}
 
-	// Scan input directory and queue files for conversion
-	go fs.ScanAndQueueFiles(*opts.WatchDir, *opts.OutputDir)
+	// Previews of the previous run have expired
+	store.ClearSamples()
 
-	// Start watching the directory
-	go fs.WatchDirectory(*opts.WatchDir, *opts.OutputDir)
+	// Restore jobs from the previous run and keep the job store up to date
+	if err := store.LoadJobs(); err != nil {
+		io.Logf("Failed to load job store: %v", io.Error, err)
+	}
+	go store.PersistJobs()
+
+	// Save the changes made since the last save before exiting
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		if err := store.SaveJobs(); err != nil {
+			io.Logf("Error saving job store: %v", io.Error, err)
+		}
+		os.Exit(0)
+	}()
+
+	// Re-queue restored jobs, then scan hot folders and queue new files
+	go func() {
+		fs.RequeueRestoredJobs()
+		for _, folder := range hotFolders {
+			fs.ScanAndQueueFiles(folder)
+		}
+	}()
+
+	// Start watching the hot folders
+	for _, folder := range hotFolders {
+		go fs.WatchDirectory(folder)
+	}
 
 	// Check the queue and process files
 	go fs.ProcessQueue()
 
+	// Allow the API to cancel, pause, resume and requeue jobs
+	api.JobControl = fs.ControlJob
+	api.EncodeSample = fs.EncodeSample
+	api.DetectCrop = fs.DetectCrop
+
 	// preprocess codecs
 	go api.InitializeCodecs()
 
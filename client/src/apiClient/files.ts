@@ -1,9 +1,42 @@
 import { useFetch } from "@/composables/useFetch";
-import { type File as MediaFile } from "~/types/files";
+import { type File as MediaFile, type JobAction, type QueueState, type SchedulePolicy, type Trim, type Sample, type SampleRequest, type Crop, type CropRect } from "~/types/files";
+import type { MediaInfo } from "~/types/media";
 
 export const getFiles = async () => useFetch<MediaFile[]>("/files");
-export const uploadFiles = async (files: File[]) => {
+export const controlJob = async (id: string, action: JobAction) =>
+  useFetch(`/files/${id}/${action}`, { method: "POST" });
+export const getProbe = async (id: string) => useFetch<MediaInfo>(`/files/${id}/probe`);
+export const outputUrl = (id: string, output: number) => `/api/files/${id}/outputs/${output}`;
+// playlist of a packaged output, segments are served next to it
+export const streamUrl = (id: string, output: number, playlist: string) =>
+  `/api/files/${id}/outputs/${output}/${playlist}`;
+export const thumbnailUrl = (id: string) => `/api/files/${id}/thumbnail`;
+export const contactSheetUrl = (id: string) => `/api/files/${id}/contact-sheet`;
+export const encodePreview = async (id: string, request: SampleRequest = {}) =>
+  useFetch<Sample>(`/files/${id}/preview`, { method: "POST", body: request });
+export const deletePreview = async (sampleId: string) =>
+  useFetch(`/previews/${sampleId}`, { method: "DELETE" });
+export const getQueue = async () => useFetch<QueueState>("/queue");
+export const setSchedulePolicy = async (policy: SchedulePolicy) =>
+  useFetch<QueueState>("/queue", { method: "POST", body: { policy } });
+export const updateQueuedJob = async (id: string, update: { priority?: number; position?: number }) =>
+  useFetch<QueueState>(`/queue/${id}`, { method: "PATCH", body: update });
+export const setTrim = async (id: string, trim: Trim) =>
+  useFetch<MediaFile>(`/files/${id}/trim`, { method: "PUT", body: trim });
+export const clearTrim = async (id: string) =>
+  useFetch<MediaFile>(`/files/${id}/trim`, { method: "DELETE" });
+export const detectCrop = async (id: string) =>
+  useFetch<Crop>(`/files/${id}/crop/detect`, { method: "POST" });
+export const setCrop = async (id: string, crop: CropRect) =>
+  useFetch<MediaFile>(`/files/${id}/crop`, { method: "PUT", body: crop });
+export const clearCrop = async (id: string) =>
+  useFetch<MediaFile>(`/files/${id}/crop`, { method: "DELETE" });
+export const uploadFiles = async (files: File[], trim?: Trim) => {
   const formData = new FormData();
+  if (trim) {
+    formData.append('in', String(trim.in));
+    if (trim.out) formData.append('out', String(trim.out));
+  }
   files.forEach(f => formData.append('files', f));
   return useFetch("/upload", { method: "POST", data: formData });
 }
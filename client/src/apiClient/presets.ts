@@ -1,4 +1,10 @@
 import { useFetch } from "@/composables/useFetch";
-import type { PresetsResponse } from "~/types/presets";
+import type { Preset, PresetsResponse } from "~/types/presets";
 
 export const getPresets = async () => useFetch<PresetsResponse>("/presets");
+export const savePreset = async (preset: Preset) =>
+  useFetch<Preset>("/presets", { method: "POST", body: { ...preset } });
+export const removePreset = async (name: string) =>
+  useFetch(`/presets?name=${encodeURIComponent(name)}`, { method: "DELETE" });
+export const assignPreset = async (preset: string, fileId?: string) =>
+  useFetch("/presets", { method: "PATCH", body: { preset, fileId } });
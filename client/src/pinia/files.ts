@@ -3,6 +3,8 @@ import { MessageTypes, type FileMessage, type File as MediaFile } from "~/types/
 import { getFiles, uploadFiles } from "~/apiClient/files";
 import { useWebSocket } from "~/composables/useWebSocket";
 import { useLoaderStore } from "./loader";
+import { useGlobalStore } from "./global";
+import type { Config } from "~/types/config";
 import type { Encoder, EncoderProfile } from "~/types/encoders";
 import { getEncoders } from "~/apiClient/encoder";
 
@@ -71,6 +73,12 @@ export const useFilesStore = defineStore("files", {
       }
 
       switch (message.type) {
+        case MessageTypes.COMMAND_ERROR:
+          console.error(message.data);
+          return;
+        case MessageTypes.UPDATE_CONFIG:
+          useGlobalStore().applySettings(message.data as unknown as Config);
+          return;
         case MessageTypes.DELETE_FILE:
           Object.keys(message.data).forEach((id: string) => {
             this.files = this.files.filter((file) => file.id !== id);
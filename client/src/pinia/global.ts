@@ -1,11 +1,13 @@
 import { defineStore } from "pinia";
 import { getConfig, updateConfig } from "~/apiClient/config";
+import type { Config } from "~/types/config";
 
 interface State {
   windowWidth: number;
   autoConvert: boolean;
   deleteAfterConvert: boolean;
   overwriteExisting: boolean;
+  concurrency: number;
 }
 
 export const useGlobalStore = defineStore("global", {
@@ -14,6 +16,7 @@ export const useGlobalStore = defineStore("global", {
     autoConvert: true,
     deleteAfterConvert: false,
     overwriteExisting: false,
+    concurrency: 1,
   }),
 
   getters: {
@@ -25,10 +28,17 @@ export const useGlobalStore = defineStore("global", {
 
   actions: {
     async fetchSettings() {
-      const config = await getConfig();
+      this.applySettings(await getConfig());
+    },
+    applySettings(config: Config) {
       this.autoConvert = config.autoConvert;
       this.deleteAfterConvert = config.deleteAfter;
       this.overwriteExisting = config.overwriteExisting;
+      this.concurrency = config.concurrency;
+    },
+    async setConcurrency(concurrency: number) {
+      this.concurrency = concurrency;
+      await updateConfig({ concurrency });
     },
     async toggleAutoConvert() {
       this.autoConvert = !this.autoConvert;
@@ -2,4 +2,6 @@ export interface Config {
   autoConvert: boolean;
   deleteAfter: boolean;
   overwriteExisting: boolean;
+  concurrency: number;
+  running?: number;
 }
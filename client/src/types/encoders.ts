@@ -19,6 +19,7 @@ export interface Encoder {
   formats: string[];
   sampleRates: number[];
   options: AVOption[];
+  unavailable?: string; // reason the encoder can't be used on the server
 }
 
 // API Request Types (chosen settings)
@@ -45,4 +46,5 @@ export interface EncoderResponse {
   defaultEncoder: EncoderProfile;
   videoEncoders: Encoder[];
   audioEncoders: Encoder[];
+  subtitleEncoders: Encoder[];
 }
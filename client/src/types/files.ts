@@ -1,9 +1,71 @@
+import type { MediaInfo } from "./media";
+
+export interface Output {
+  preset: string;
+  outputDir: string;
+  filePath: string;
+  status: FileStatuses;
+  progress: number;
+  error?: string;
+  reason?: FailureReason;
+  attempts: number;
+  videoEncoder?: string;
+  audioEncoder?: string;
+  package?: 'hls' | 'dash';
+  subtitles?: string[]; // subtitle files written next to the output
+}
+
+export type FailureReason = 'input_unreadable' | 'encoder_missing' | 'disk_full' | 'device_busy' | 'cancelled' | 'invalid_preset' | 'unknown';
+
+export interface StatusChange {
+  status: FileStatuses;
+  time: string;
+}
+
+export interface Trim {
+  in: number; // seconds, HH:MM:SS.ms strings are also accepted by the server
+  out?: number; // omitted to convert to the end of the source
+}
+
+export interface SubtitleFile {
+  path: string;
+  language?: string; // tag between the source name and the extension, e.g. eng for movie.eng.srt
+}
+
+export interface CropRect {
+  width: number;
+  height: number;
+  x: number;
+  y: number;
+}
+
+export interface Crop {
+  detected?: CropRect;
+  override?: CropRect; // replaces the detected crop
+}
+
+export interface Previews {
+  thumbnail: boolean;
+  contactSheet: boolean;
+}
+
 export interface File {
   id: string;
   filePath: string;
+  watchDir?: string;
+  hotFolder?: string;
   status: FileStatuses;
   progress: number;
-  duration: number; // in seconds
+  duration: number; // in seconds, the length of the trim range when trimmed
+  trim?: Trim;
+  crop?: Crop; // applied to outputs of presets with autoCrop
+  media?: MediaInfo;
+  subtitles?: SubtitleFile[];
+  previews?: Previews;
+  outputs: Output[];
+  error?: string;
+  priority?: number;
+  history?: StatusChange[];
 }
 
 export enum MessageTypes {
@@ -11,12 +73,33 @@ export enum MessageTypes {
   UPDATE_FILE = 'update_file',
   DELETE_FILE = 'delete_file',
   REFRESH_FILES = 'refresh_files',
+  COMMAND_ERROR = 'command_error',
+  UPDATE_CONFIG = 'update_config',
+}
+
+export type JobAction = 'cancel' | 'pause' | 'resume' | 'requeue';
+
+export type SchedulePolicy = 'fifo' | 'shortest' | 'round-robin';
+
+export interface QueueEntry {
+  fileId: string;
+  filePath: string;
+  hotFolder: string;
+  duration: number;
+  priority: number;
+  position: number;
+}
+
+export interface QueueState {
+  policy: SchedulePolicy;
+  jobs: QueueEntry[];
 }
 
 export enum FileStatuses {
   NEW = 'new',
   QUEUED = 'queued',
   PROCESSING = 'processing',
+  PAUSED = 'paused',
   COMPLETED = 'completed',
   COMPLETEDELETED = 'completed-deleted',
   CANCELLED = 'cancelled',
@@ -29,3 +112,21 @@ export interface FileMessage {
   type: MessageTypes;
   data: File[];
 }
+
+export interface SampleRequest {
+  preset?: string; // defaults to the preset of the first output
+  start?: number | string; // seconds or HH:MM:SS.ms, defaults to the trim in point
+  length?: number; // seconds, defaults to the server --preview-length
+}
+
+export interface Sample {
+  id: string;
+  fileId: string;
+  preset: string;
+  start: number;
+  length: number;
+  videoEncoder?: string;
+  audioEncoder?: string;
+  url: string;
+  expires: string;
+}
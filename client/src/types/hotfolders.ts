@@ -0,0 +1,9 @@
+export interface HotFolder {
+  name: string;
+  watchDir: string;
+  outputDir: string;
+  presets: string[];
+  autoConvert?: boolean;
+  deleteAfter?: boolean;
+  default?: boolean;
+}
@@ -0,0 +1,31 @@
+export interface MediaStream {
+  index: number;
+  type: 'video' | 'audio' | 'subtitle' | 'data' | 'attachment';
+  codec: string;
+  profile?: string;
+  width?: number;
+  height?: number;
+  frameRate?: number;
+  pixelFormat?: string;
+  channels?: number;
+  channelLayout?: string;
+  sampleRate?: number;
+  bitRate?: number;
+  rotation?: number;
+  colorSpace?: string;
+  colorTransfer?: string;
+  colorPrimaries?: string;
+  colorRange?: string;
+  language?: string;
+  duration?: number;
+  attachedPic?: boolean;
+}
+
+export interface MediaInfo {
+  format: string;
+  duration: number;
+  bitRate?: number;
+  size?: number;
+  timecode?: string;
+  streams: MediaStream[];
+}
@@ -1,25 +1,125 @@
 export type AVOption = Record<string, string>
 
+export type ScaleMode = 'keep' | 'max' | 'fit' | 'fill' | 'pad';
+
+export interface ScaleRule {
+  mode: ScaleMode;
+  width?: number;
+  height?: number;
+  minWidth?: number;
+  minHeight?: number;
+  rounding?: number;
+  matchOrientation?: boolean;
+}
+
+// a single encoder, or candidates in order of preference
+export type CodecList = string | string[];
+
+export type RateMode = 'quality' | 'cbr' | 'vbr' | '2pass' | 'size';
+
+export interface RateControl {
+  mode: RateMode;
+  quality?: number;
+  bitrate?: string;
+  maxRate?: string;
+  bufSize?: string;
+  targetSize?: string;
+}
+
+export type PackageFormat = 'hls' | 'dash';
+
+export interface Rendition {
+  height: number;
+  bitrate: string;
+}
+
+export interface Packaging {
+  format: PackageFormat;
+  segmentLength?: number;
+  ladder?: Rendition[];
+}
+
+export type SelectMode = 'first' | 'all' | 'none' | 'tracks' | 'languages';
+
+export interface StreamSelection {
+  mode: SelectMode;
+  tracks?: number[]; // stream indices from the probe
+  languages?: string[];
+}
+
+export interface StreamMap {
+  video?: StreamSelection;
+  audio?: StreamSelection;
+  data?: boolean;
+  timecode?: boolean;
+}
+
+export type SubtitleMode = 'none' | 'copy' | 'convert' | 'sidecar' | 'burn';
+
+export interface SubtitlePreset {
+  mode: SubtitleMode;
+  codec?: string; // subtitle encoder for convert and sidecar, e.g. mov_text or srt
+  select?: StreamSelection;
+}
+
+export type FilterType = 'deinterlace' | 'crop' | 'denoise' | 'lut' | 'fps' | 'rotate' | 'resample' | 'volume';
+
+// only the fields of the filter type are used
+export interface Filter {
+  type: FilterType;
+  method?: string; // deinterlace: yadif or bwdif, denoise: hqdn3d or nlmeans
+  width?: number;
+  height?: number;
+  x?: number; // crops are centred when omitted
+  y?: number;
+  strength?: number;
+  file?: string; // LUT file on the server
+  rate?: string; // frame rate or sample rate
+  angle?: 90 | 180 | 270;
+  gain?: string; // e.g. 0.5 or -3dB
+}
+
 export interface VideoPreset {
-  codec: string;
+  codec: CodecList;
   format: string;
   options: AVOption[];
+  scale?: ScaleRule;
+  rateControl?: RateControl;
+  filters?: Filter[];
+  autoCrop?: boolean;
 }
 
 export interface AudioPreset {
-  codec: string;
-  sampleRate: number;
+  codec: CodecList;
+  sampleRate: string | null;
+  format?: string; // sample format, e.g. s32 or fltp
+  channels?: number;
+  bitrate?: string;
   options: AVOption[];
+  filters?: Filter[];
 }
 
 export interface Preset {
   name: string;
+  default?: boolean;
   description: string;
   extension: string;
-  video: VideoPreset;
+  video?: VideoPreset; // omitted for audio-only presets
   audio: AudioPreset;
+  packaging?: Packaging;
+  streams?: StreamMap;
+  subtitles?: SubtitlePreset;
+  usable?: boolean;
+  videoEncoder?: string;
+  audioEncoder?: string;
+  missing?: ('video' | 'audio' | 'subtitles')[];
 }
 
 export interface PresetsResponse {
   presets: Preset[];
 }
+
+export interface OutputRule {
+  preset: string;
+  outputDir: string;
+}
@@ -1,19 +1,27 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
 	"blockbuffer/internal/types"
 	// opts "blockbuffer/internal/settings"
 )
 
 var Cmd *exec.Cmd
 
+const encoderCheckTimeout = 15 * time.Second
+
 // return all presets
 func GetPresets(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -22,20 +30,83 @@ func GetPresets(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Printf("types.Presets: %v\n", types.Presets)
-	for _, preset := range types.Presets {
-		fmt.Printf("preset: %v\n", preset)
+	types.PresetsMutex.Lock()
+	presets := make(map[string]presetStatus, len(types.Presets))
+	for name, preset := range types.Presets {
+		presets[name] = presetStatus{PresetBundle: preset}
+	}
+	types.PresetsMutex.Unlock()
+
+	for name, status := range presets {
+		presets[name] = resolvePresetStatus(status.PresetBundle)
+	}
+	io.SuccessJSON(w, presets)
+}
+
+// presetStatus is a preset with the encoders it would run with on this machine
+type presetStatus struct {
+	types.PresetBundle
+	Usable       bool     `json:"usable"`
+	VideoEncoder string   `json:"videoEncoder,omitempty"`
+	AudioEncoder string   `json:"audioEncoder,omitempty"`
+	Missing      []string `json:"missing,omitempty"` // streams without a usable encoder: video, audio, subtitles
+}
+
+// resolvePresetStatus picks the encoders of a preset, a preset is unusable
+// when none of the candidates for a stream can be used
+func resolvePresetStatus(preset types.PresetBundle) presetStatus {
+	status := presetStatus{PresetBundle: preset, Usable: true}
+	if name, ok := preset.VideoPreset.Codec.Resolve(types.Video); ok {
+		status.VideoEncoder = name
+	} else if !preset.AudioOnly() {
+		status.Missing = append(status.Missing, "video")
+	}
+	if name, ok := preset.AudioPreset.Codec.Resolve(types.Audio); ok {
+		status.AudioEncoder = name
+	} else if len(preset.AudioPreset.Codec) > 0 {
+		status.Missing = append(status.Missing, "audio")
 	}
-	io.SuccessJSON(w, types.Presets)
+	if subtitles := preset.Subtitles; subtitles != nil && subtitles.Codec != "" {
+		if _, ok := (types.CodecList{subtitles.Codec}).Resolve(types.Subtitle); !ok {
+			status.Missing = append(status.Missing, "subtitles")
+		}
+	}
+	status.Usable = len(status.Missing) == 0
+	return status
 }
 
-// add preset to list
+type presetAssignment struct {
+	FileID string `json:"fileId"` // empty to assign the global preset
+	Preset string `json:"preset"` // empty to remove the assignment
+}
+
+// add preset to list, or update an existing user preset
 func AddPreset(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		io.ErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	var preset types.PresetBundle
+	if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+		io.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	if types.ListEncoders() == nil {
+		io.ErrorJSON(w, "Encoders have not been detected yet", http.StatusServiceUnavailable)
+		return
+	}
+	if errs := preset.Validate(); len(errs) > 0 {
+		io.FieldErrorJSON(w, "Invalid preset", errs)
+		return
+	}
+
+	if err := types.AddPreset(preset); err != nil {
+		presetError(w, err)
+		return
+	}
+	io.SuccessJSON(w, "Preset saved", preset)
 }
 
 // remove preset from list
@@ -45,6 +116,31 @@ func RemovePreset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		io.ErrorJSON(w, "Missing preset name", http.StatusBadRequest)
+		return
+	}
+
+	for _, rule := range types.GetOutputRules() {
+		if rule.Preset == name {
+			io.ErrorJSON(w, "Preset is used by an output rule", http.StatusConflict)
+			return
+		}
+	}
+	for _, folder := range types.ListHotFolders() {
+		if slices.Contains(folder.Presets, name) {
+			io.ErrorJSON(w, fmt.Sprintf("Preset is used by hot folder %s", folder.Name), http.StatusConflict)
+			return
+		}
+	}
+
+	if err := types.RemovePreset(name); err != nil {
+		presetError(w, err)
+		return
+	}
+	store.UnbindPreset(name)
+	io.SuccessJSON(w, "Preset removed")
 }
 
 // assign preset to file task
@@ -54,6 +150,86 @@ func AssignPreset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var assignment presetAssignment
+	if err := json.NewDecoder(r.Body).Decode(&assignment); err != nil {
+		io.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	if assignment.Preset != "" {
+		if _, ok := types.GetPreset(assignment.Preset); !ok {
+			io.FieldErrorJSON(w, "Invalid assignment", map[string]string{"preset": "preset not found"})
+			return
+		}
+	}
+
+	if assignment.FileID == "" {
+		store.SetGlobalBinding(assignment.Preset)
+		io.SuccessJSON(w, "Global preset assigned", assignment)
+		return
+	}
+
+	if _, ok := store.GetFile(assignment.FileID); !ok {
+		io.FieldErrorJSON(w, "Invalid assignment", map[string]string{"fileId": "file not found"})
+		return
+	}
+	store.BindPreset(assignment.FileID, assignment.Preset)
+	io.SuccessJSON(w, "Preset assigned", assignment)
+}
+
+// return the output rules used to fan files out to multiple outputs
+func GetOutputRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		io.ErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	io.SuccessJSON(w, types.GetOutputRules())
+}
+
+// replace the output rules, an empty list produces a single output per file
+func SetOutputRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		io.ErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var rules []types.OutputRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		io.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	errs := map[string]string{}
+	for i, rule := range rules {
+		if rule.Preset == "" {
+			continue
+		}
+		if _, ok := types.GetPreset(rule.Preset); !ok {
+			errs[fmt.Sprintf("rules.%d.preset", i)] = "preset not found"
+		}
+	}
+	if len(errs) > 0 {
+		io.FieldErrorJSON(w, "Invalid output rules", errs)
+		return
+	}
+
+	if err := types.SetOutputRules(rules); err != nil {
+		io.ErrorJSON(w, "Failed to save output rules", http.StatusInternalServerError)
+		return
+	}
+	io.SuccessJSON(w, "Output rules saved", rules)
+}
+
+// presetError maps preset store errors to http responses
+func presetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, types.ErrDefaultPreset):
+		io.ErrorJSON(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, types.ErrPresetNotFound):
+		io.ErrorJSON(w, err.Error(), http.StatusNotFound)
+	default:
+		io.ErrorJSON(w, "Failed to save presets", http.StatusInternalServerError)
+	}
 }
 
 func HandleEncoder(w http.ResponseWriter, r *http.Request) {
@@ -63,31 +239,35 @@ func HandleEncoder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// If Encoders is not nil, send the JSON response
-	if types.Encoders != nil {
+	if encoders := types.ListEncoders(); encoders != nil {
 		VideoEncoders := []types.Encoder{}
 		AudioEncoders := []types.Encoder{}
-		for _, encoder := range types.Encoders {
-			if encoder.Type == types.Video {
+		SubtitleEncoders := []types.Encoder{}
+		for _, encoder := range encoders {
+			switch encoder.Type {
+			case types.Video:
 				VideoEncoders = append(VideoEncoders, encoder)
-			}
-			if encoder.Type == types.Audio {
+			case types.Audio:
 				AudioEncoders = append(AudioEncoders, encoder)
+			case types.Subtitle:
+				SubtitleEncoders = append(SubtitleEncoders, encoder)
 			}
 		}
 		io.SuccessJSON(w, map[string]interface{}{
-			"defaultEncoder": types.DefaultEncoder,
-			"videoEncoders":  VideoEncoders,
-			"audioEncoders":  AudioEncoders,
+			"defaultEncoder":   types.DefaultEncoder,
+			"videoEncoders":    VideoEncoders,
+			"audioEncoders":    AudioEncoders,
+			"subtitleEncoders": SubtitleEncoders,
 		})
 		return
 	}
 
 	InitializeCodecs()
-	io.SuccessJSON(w, types.Encoders)
+	io.SuccessJSON(w, types.ListEncoders())
 }
 
 func InitializeCodecs() {
-	// Get video and audio codecs from ffmpeg
+	// Get video, audio and subtitle codecs from ffmpeg
 	Cmd = exec.Command("ffmpeg", "-encoders")
 	encoders, err := Cmd.Output()
 	if err != nil {
@@ -117,10 +297,13 @@ func InitializeCodecs() {
 		A....D aac                  AAC (Advanced Audio Coding)
 		AF...D flac                 FLAC (Free Lossless Audio Codec)
 		A....D wavesynth            Wave synthesis pseudo-codec
+		S..... ass                  ASS (Advanced SubStation Alpha) subtitle
+		S..... mov_text             3GPP Timed Text subtitle
 		*
-		* We need to extract the codecs, group them by video or audio, and include their name and description from each line and group them by type.
+		* We need to extract the codecs, group them by video, audio or subtitle, and include their name and description from each line and group them by type.
 	**/
 	var ready = false
+	var detected = []types.Encoder{}
 	for _, line := range strings.Split(string(encoders), "\n") {
 		line = strings.TrimSpace(line)
 		if !ready || line == "" {
@@ -130,16 +313,66 @@ func InitializeCodecs() {
 			continue
 		}
 
-		if line[0] == 'V' || line[0] == 'A' {
+		if line[0] == 'V' || line[0] == 'A' || line[0] == 'S' {
 			name := strings.Split(line, " ")[1]
 			desc := strings.Split(line, " ")[2:]
 			codec, err := buildOptions(name, types.EncoderType(line[0]), strings.TrimSpace(strings.Join(desc, "")))
 			if err != nil {
 				continue
 			}
-			types.Encoders = append(types.Encoders, codec)
+			detected = append(detected, codec)
+		}
+	}
+
+	// hardware encoders are listed even without a device, check they can open
+	for i, encoder := range detected {
+		if encoder.Type == types.Video && types.IsHardwareEncoder(encoder.Name) {
+			if err := checkEncoder(encoder.Name); err != nil {
+				io.Logf("Encoder %s is not usable: %v", io.Info, encoder.Name, err)
+				detected[i].Unavailable = err.Error()
+			}
+		}
+	}
+	types.SetEncoders(detected)
+	detectFilters()
+}
+
+// detectFilters lists the filters of the local ffmpeg so preset filter chains
+// can be validated
+func detectFilters() {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+	if err != nil {
+		io.Logf("Error getting filters: %v", io.Error, err)
+		return
+	}
+
+	// filters are listed as flags, name, input->output and description, e.g.
+	// " T.. yadif             V->V       Deinterlace the input image."
+	filters := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && len(fields[0]) == 3 && strings.Contains(fields[2], "->") {
+			filters = append(filters, fields[1])
+		}
+	}
+	types.SetFilters(filters)
+}
+
+// checkEncoder encodes a single blank frame to test that an encoder can open
+func checkEncoder(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), encoderCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "color=black:s=256x256:d=0.1", "-frames:v", "1",
+		"-c:v", name, "-f", "null", "-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if lines := strings.Split(strings.TrimSpace(string(output)), "\n"); lines[0] != "" {
+			return errors.New(lines[len(lines)-1])
 		}
+		return err
 	}
+	return nil
 }
 
 func buildOptions(encoderName string, encType types.EncoderType, desc string) (types.Encoder, error) {
@@ -160,8 +393,9 @@ func buildOptions(encoderName string, encType types.EncoderType, desc string) (t
 	}
 
 	// Parse the options...
-	// Audio and Video options are somewhat different, so we need to parse them differently
-	if encType == types.Video {
+	// Audio and Video options are somewhat different, so we need to parse them differently,
+	// subtitle encoders only list options, parsed like video without pixel formats
+	if encType == types.Video || encType == types.Subtitle {
 		// Parse video options
 		formats, options := processVideoOptions(string(encoderOptions))
 		encoder.Formats = formats
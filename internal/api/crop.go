@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// DetectCrop runs crop detection on a file, set by the conversion queue at startup
+var DetectCrop func(fileId string) (types.Crop, error)
+
+// detect the crop of a file now, replacing an earlier detection
+func detectCropHandler(w http.ResponseWriter, r *http.Request) {
+	if DetectCrop == nil {
+		io.ErrorJSON(w, "crop detection is not available", http.StatusInternalServerError)
+		return
+	}
+	crop, err := DetectCrop(r.PathValue("id"))
+	if err != nil {
+		io.ErrorJSON(w, err.Error(), cropErrorCode(err))
+		return
+	}
+	io.SuccessJSON(w, crop)
+}
+
+// override the detected crop of a job
+func setCrop(w http.ResponseWriter, r *http.Request) {
+	var rect types.CropRect
+	if err := json.NewDecoder(r.Body).Decode(&rect); err != nil {
+		io.ErrorJSON(w, fmt.Sprintf("Failed to decode request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	updateCrop(w, r.PathValue("id"), &rect)
+}
+
+// go back to the detected crop
+func clearCrop(w http.ResponseWriter, r *http.Request) {
+	updateCrop(w, r.PathValue("id"), nil)
+}
+
+func updateCrop(w http.ResponseWriter, fileId string, rect *types.CropRect) {
+	var err error
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		// running encodes already use the previous crop
+		if file.Status == types.Processing || file.Status == types.Paused {
+			err = fmt.Errorf("%w: cannot crop a %s job", types.ErrInvalidJobState, file.Status)
+			return
+		}
+		if rect != nil {
+			var width, height int
+			if video := file.Media.Video(); video != nil {
+				width, height = video.DisplaySize()
+			}
+			if err = rect.Validate(width, height); err != nil {
+				return
+			}
+		}
+		crop := types.Crop{}
+		if file.Crop != nil {
+			crop = *file.Crop
+		}
+		crop.Override = rect
+		file.Crop = &crop
+	})
+	if !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		io.ErrorJSON(w, err.Error(), cropErrorCode(err))
+		return
+	}
+
+	BroadcastMessage(types.Message{
+		MessageType: types.UpdateFile,
+		MustSend:    true,
+		Data:        map[string]types.File{file.ID: file},
+	})
+	io.SuccessJSON(w, file)
+}
+
+func cropErrorCode(err error) int {
+	if errors.Is(err, types.ErrInvalidCrop) {
+		return http.StatusBadRequest
+	}
+	return jobErrorCode(err)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// stream a converted output, http.ServeContent handles Range and conditional requests
+func downloadOutput(w http.ResponseWriter, r *http.Request) {
+	file, ok := store.GetFile(r.PathValue("id"))
+	if !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n >= len(file.Outputs) {
+		io.ErrorJSON(w, "output not found", http.StatusNotFound)
+		return
+	}
+	output := file.Outputs[n]
+	if output.Status != types.Completed {
+		io.ErrorJSON(w, fmt.Sprintf("output is %s", output.Status), http.StatusConflict)
+		return
+	}
+	if !inOutputDir(output.FilePath) {
+		io.Logf("Refusing to serve %s outside the output directories", io.Warn, output.FilePath)
+		io.ErrorJSON(w, "output is outside the output directories", http.StatusForbidden)
+		return
+	}
+
+	f, err := os.Open(output.FilePath)
+	if err != nil {
+		io.ErrorJSON(w, "output file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		io.ErrorJSON(w, "output file not found", http.StatusNotFound)
+		return
+	}
+
+	name := filepath.Base(output.FilePath)
+	w.Header().Set("Content-Type", mediaType(name))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// serve the playlists and segments of a packaged output so players can stream it
+func streamOutput(w http.ResponseWriter, r *http.Request) {
+	file, ok := store.GetFile(r.PathValue("id"))
+	if !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n >= len(file.Outputs) || file.Outputs[n].Package == "" {
+		io.ErrorJSON(w, "packaged output not found", http.StatusNotFound)
+		return
+	}
+	output := file.Outputs[n]
+	// playlists are readable while the segments are being written
+	if output.Status != types.Completed && output.Status != types.Processing {
+		io.ErrorJSON(w, fmt.Sprintf("output is %s", output.Status), http.StatusConflict)
+		return
+	}
+
+	name := filepath.Clean("/" + r.PathValue("path"))
+	path := filepath.Join(output.OutputDir, name)
+	if !inOutputDir(path) {
+		io.ErrorJSON(w, "segment not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType(path))
+	http.ServeFile(w, r, path)
+}
+
+// mediaTypes covers containers missing from the system mime types
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".mxf":  "application/mxf",
+	".avi":  "video/x-msvideo",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mpd":  "application/dash+xml",
+}
+
+// mediaType returns the content type of a media file, the api handler
+// defaults every response to json
+func mediaType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// inOutputDir checks a path is inside one of the configured output
+// directories, after resolving symlinks
+func inOutputDir(path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	dirs := []string{*opts.OutputDir}
+	for _, folder := range types.ListHotFolders() {
+		dirs = append(dirs, folder.OutputDir)
+	}
+	for _, rule := range types.GetOutputRules() {
+		if rule.OutputDir != "" {
+			dirs = append(dirs, rule.OutputDir)
+		}
+	}
+	for _, dir := range dirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	// loading the presets at init writes a blank config next to the tests
+	if data, err := os.ReadFile(*opts.PresetConfigPath); err == nil && string(data) == `{"presets":[]}` {
+		os.Remove(*opts.PresetConfigPath)
+	}
+	os.Exit(m.Run())
+}
+
+// trackOutputs points the output directory at a temporary directory and
+// tracks a job with the given outputs
+func trackOutputs(t *testing.T, outputs ...types.Output) string {
+	t.Helper()
+	prev := *opts.OutputDir
+	*opts.OutputDir = t.TempDir()
+	file := types.File{ID: "download", Status: types.Completed, Outputs: outputs}
+	for i := range file.Outputs {
+		file.Outputs[i].FilePath = filepath.Join(*opts.OutputDir, file.Outputs[i].FilePath)
+		file.Outputs[i].OutputDir = filepath.Join(*opts.OutputDir, file.Outputs[i].OutputDir)
+	}
+	store.UpdateFile(file)
+	t.Cleanup(func() {
+		*opts.OutputDir = prev
+		store.RemoveFile(file.ID)
+	})
+	return *opts.OutputDir
+}
+
+func writeOutput(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	apiHandler(w, r)
+	return w
+}
+
+func TestDownloadOutput(t *testing.T) {
+	dir := trackOutputs(t, types.Output{FilePath: "movie.mp4", Status: types.Completed})
+	writeOutput(t, filepath.Join(dir, "movie.mp4"), "0123456789")
+
+	full := get("/files/download/outputs/0", nil)
+	if full.Code != http.StatusOK || full.Body.String() != "0123456789" {
+		t.Fatalf("got %d %q, want the whole output", full.Code, full.Body.String())
+	}
+	if got := full.Header().Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("Content-Type = %q, want video/mp4", got)
+	}
+	if got := full.Header().Get("Content-Disposition"); got != `attachment; filename=movie.mp4` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	etag := full.Header().Get("ETag")
+	if etag == "" || full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("ETag = %q, Accept-Ranges = %q, want both set", etag, full.Header().Get("Accept-Ranges"))
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		code    int
+		body    string
+		content string // Content-Range
+	}{
+		{"range", http.Header{"Range": {"bytes=2-5"}}, http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"suffix range", http.Header{"Range": {"bytes=-3"}}, http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"range past the end", http.Header{"Range": {"bytes=20-"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"unchanged", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, "", ""},
+		{"changed", http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK, "0123456789", ""},
+		{"range of the same version", http.Header{"Range": {"bytes=0-1"}, "If-Range": {etag}}, http.StatusPartialContent, "01", "bytes 0-1/10"},
+		{"range of a replaced version", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"stale"`}}, http.StatusOK, "0123456789", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get("/files/download/outputs/0", tt.header)
+			if w.Code != tt.code {
+				t.Fatalf("got status %d, want %d", w.Code, tt.code)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("got body %q, want %q", w.Body.String(), tt.body)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.content {
+				t.Errorf("Content-Range = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestDownloadOutputRefusals(t *testing.T) {
+	outside := t.TempDir()
+	writeOutput(t, filepath.Join(outside, "secret.mp4"), "secret")
+
+	dir := trackOutputs(t,
+		types.Output{FilePath: "converting.mp4", Status: types.Processing},
+		types.Output{FilePath: "link.mp4", Status: types.Completed},
+		types.Output{FilePath: "linked/secret.mp4", Status: types.Completed},
+		types.Output{FilePath: "missing.mp4", Status: types.Completed},
+	)
+	writeOutput(t, filepath.Join(dir, "converting.mp4"), "partial")
+	if err := os.Symlink(filepath.Join(outside, "secret.mp4"), filepath.Join(dir, "link.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{"unfinished output", "/files/download/outputs/0", http.StatusConflict},
+		{"symlink out of the output directory", "/files/download/outputs/1", http.StatusForbidden},
+		{"symlinked directory", "/files/download/outputs/2", http.StatusForbidden},
+		{"missing file", "/files/download/outputs/3", http.StatusForbidden},
+		{"unknown output", "/files/download/outputs/9", http.StatusNotFound},
+		{"unknown job", "/files/nothing/outputs/0", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.path, nil)
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+			if w.Body.String() == "secret" {
+				t.Error("served a file outside the output directories")
+			}
+		})
+	}
+}
+
+func TestStreamOutputStaysInPackage(t *testing.T) {
+	outside := t.TempDir()
+	writeOutput(t, filepath.Join(outside, "secret.ts"), "secret")
+
+	dir := trackOutputs(t, types.Output{FilePath: "show/master.m3u8", OutputDir: "show", Package: types.PackageHLS, Status: types.Completed})
+	writeOutput(t, filepath.Join(dir, "show", "master.m3u8"), "#EXTM3U")
+	if err := os.Symlink(filepath.Join(outside, "secret.ts"), filepath.Join(dir, "show", "stream_0_00001.ts")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := get("/files/download/outputs/0/master.m3u8", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "#EXTM3U" || w.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Errorf("playlist: got %d %q as %q", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	if w := get("/files/download/outputs/0/stream_0_00001.ts", nil); w.Code != http.StatusNotFound {
+		t.Errorf("symlinked segment: got %d, want 404", w.Code)
+	}
+	// the router redirects dot segments to the cleaned path rather than serving them
+	if w := get("/files/download/outputs/0/../../"+filepath.Base(outside)+"/secret.ts", nil); w.Code == http.StatusOK || w.Body.String() == "secret" {
+		t.Errorf("dot segments: got %d, want the file to stay hidden", w.Code)
+	}
+}
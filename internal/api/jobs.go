@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"blockbuffer/internal/io"
+	types "blockbuffer/internal/types"
+)
+
+// JobControl applies job actions, set by the conversion queue at startup
+var JobControl func(fileId string, action types.JobAction) error
+
+// control a job: cancel, pause, resume or requeue
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	err := runJobAction(r.PathValue("id"), types.JobAction(r.PathValue("action")))
+	if err != nil {
+		io.ErrorJSON(w, err.Error(), jobErrorCode(err))
+		return
+	}
+	io.SuccessJSON(w, "success")
+}
+
+func runJobAction(fileId string, action types.JobAction) error {
+	if JobControl == nil {
+		return errors.New("job control is not available")
+	}
+	return JobControl(fileId, action)
+}
+
+// jobErrorCode maps job control errors to http status codes
+func jobErrorCode(err error) int {
+	switch {
+	case errors.Is(err, types.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrUnknownAction):
+		return http.StatusBadRequest
+	case errors.Is(err, types.ErrInvalidJobState):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// serve the poster frame of a source
+func thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	servePreview(w, r, func(previews types.Previews) (string, bool) {
+		return store.ThumbnailPath(r.PathValue("id")), previews.Thumbnail
+	})
+}
+
+// serve the contact sheet of a source
+func contactSheetHandler(w http.ResponseWriter, r *http.Request) {
+	servePreview(w, r, func(previews types.Previews) (string, bool) {
+		return store.ContactSheetPath(r.PathValue("id")), previews.ContactSheet
+	})
+}
+
+func servePreview(w http.ResponseWriter, r *http.Request, preview func(previews types.Previews) (string, bool)) {
+	file, ok := store.GetFile(r.PathValue("id"))
+	if !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	path, ok := preview(file.Previews)
+	if !ok {
+		io.ErrorJSON(w, "preview not available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+type queueState struct {
+	Policy types.SchedulePolicy `json:"policy"`
+	Jobs   []types.QueueEntry   `json:"jobs"`
+}
+
+type queuePolicy struct {
+	Policy types.SchedulePolicy `json:"policy"`
+}
+
+// queueUpdate changes the priority and/or position of a queued job
+type queueUpdate struct {
+	Priority *int `json:"priority"`
+	Position *int `json:"position"`
+}
+
+// list the waiting jobs in the order they will be converted
+func getQueue(w http.ResponseWriter, r *http.Request) {
+	io.SuccessJSON(w, queueState{Policy: store.GetPolicy(), Jobs: store.QueuedJobs()})
+}
+
+// change the schedule policy
+func setQueuePolicy(w http.ResponseWriter, r *http.Request) {
+	var body queuePolicy
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		io.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if err := store.SetPolicy(body.Policy); err != nil {
+		io.ErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	io.Logf("Schedule policy set to %s", io.Info, body.Policy)
+	io.SuccessJSON(w, queueState{Policy: store.GetPolicy(), Jobs: store.QueuedJobs()})
+}
+
+// reprioritize or reorder a queued job
+func updateQueuedJob(w http.ResponseWriter, r *http.Request) {
+	var body queueUpdate
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		io.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if body.Priority == nil && body.Position == nil {
+		io.ErrorJSON(w, "priority or position is required", http.StatusBadRequest)
+		return
+	}
+
+	fileId := r.PathValue("id")
+	if _, ok := store.GetFile(fileId); !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if body.Priority != nil {
+		file, err := store.SetJobPriority(fileId, *body.Priority)
+		if err != nil {
+			io.ErrorJSON(w, err.Error(), queueErrorCode(err))
+			return
+		}
+		BroadcastMessage(types.Message{
+			MessageType: types.UpdateFile,
+			MustSend:    true,
+			Data:        map[string]types.File{file.ID: file},
+		})
+	}
+	// moves are checked against the new priority
+	if body.Position != nil {
+		if err := store.MoveJob(fileId, *body.Position); err != nil {
+			io.ErrorJSON(w, err.Error(), queueErrorCode(err))
+			return
+		}
+	}
+	io.SuccessJSON(w, queueState{Policy: store.GetPolicy(), Jobs: store.QueuedJobs()})
+}
+
+func queueErrorCode(err error) int {
+	switch {
+	case errors.Is(err, types.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrNotQueued), errors.Is(err, types.ErrInvalidPosition):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	appIO "blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+const sampleTimeout = 5 * time.Minute // previews waiting for a slot or encoding longer are cancelled
+
+// EncodeSample encodes a preview of a file, set by the conversion queue at startup
+var EncodeSample func(ctx context.Context, fileId string, req types.SampleRequest) (types.Sample, error)
+
+// encode a short preview of a file with a preset
+func sampleHandler(w http.ResponseWriter, r *http.Request) {
+	var req types.SampleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		appIO.ErrorJSON(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if EncodeSample == nil {
+		appIO.ErrorJSON(w, "previews are not available", http.StatusInternalServerError)
+		return
+	}
+	// the encode stops when the client disconnects or the timeout passes
+	ctx, cancel := context.WithTimeout(r.Context(), sampleTimeout)
+	defer cancel()
+	sample, err := EncodeSample(ctx, r.PathValue("id"), req)
+	if err != nil {
+		appIO.ErrorJSON(w, err.Error(), sampleErrorCode(err))
+		return
+	}
+	appIO.SuccessJSON(w, sample)
+}
+
+// stream a preview encode
+func getSample(w http.ResponseWriter, r *http.Request) {
+	sample, ok := store.GetSample(r.PathValue("id"))
+	if !ok {
+		appIO.ErrorJSON(w, types.ErrSampleNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType(sample.FilePath))
+	http.ServeFile(w, r, sample.FilePath)
+}
+
+// delete a preview encode before it expires
+func removeSample(w http.ResponseWriter, r *http.Request) {
+	if err := store.RemoveSample(r.PathValue("id")); err != nil {
+		appIO.ErrorJSON(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	appIO.SuccessJSON(w, "success")
+}
+
+func sampleErrorCode(err error) int {
+	switch {
+	case errors.Is(err, types.ErrFileNotFound), errors.Is(err, types.ErrPresetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrInvalidTrim):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
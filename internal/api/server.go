@@ -24,6 +24,7 @@ type Config struct {
 	AutoConvert       *bool `json:"autoConvert,omitempty"`
 	DeleteAfter       *bool `json:"deleteAfter,omitempty"`
 	OverwriteExisting *bool `json:"overwriteExisting,omitempty"`
+	Concurrency       *int  `json:"concurrency,omitempty"`
 }
 
 func isDevServer() bool {
@@ -103,22 +104,38 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 	router.HandleFunc("GET /config", configHandler)
 	router.HandleFunc("POST /config", configHandler)
 	router.HandleFunc("GET /files", filesHandler)
+	router.HandleFunc("GET /files/{id}/probe", probeHandler)
+	router.HandleFunc("GET /files/{id}/thumbnail", thumbnailHandler)
+	router.HandleFunc("GET /files/{id}/contact-sheet", contactSheetHandler)
+	router.HandleFunc("GET /files/{id}/outputs/{n}", downloadOutput)
+	router.HandleFunc("GET /files/{id}/outputs/{n}/{path...}", streamOutput)
+	router.HandleFunc("POST /files/{id}/{action}", jobHandler)
+	router.HandleFunc("POST /files/{id}/preview", sampleHandler)
+	router.HandleFunc("GET /previews/{id}", getSample)
+	router.HandleFunc("DELETE /previews/{id}", removeSample)
+	router.HandleFunc("PUT /files/{id}/trim", setTrim)
+	router.HandleFunc("DELETE /files/{id}/trim", clearTrim)
+	router.HandleFunc("POST /files/{id}/crop/detect", detectCropHandler)
+	router.HandleFunc("PUT /files/{id}/crop", setCrop)
+	router.HandleFunc("DELETE /files/{id}/crop", clearCrop)
+	router.HandleFunc("GET /queue", getQueue)
+	router.HandleFunc("POST /queue", setQueuePolicy)
+	router.HandleFunc("PATCH /queue/{id}", updateQueuedJob)
 	router.HandleFunc("POST /upload", HandleUploadMultipleFiles)
 	router.HandleFunc("GET /encoders", HandleEncoder)
 	router.HandleFunc("GET /presets", GetPresets)
 	router.HandleFunc("POST /presets", AddPreset)
 	router.HandleFunc("PATCH /presets", AssignPreset)
 	router.HandleFunc("DELETE /presets", RemovePreset)
+	router.HandleFunc("GET /hotfolders", hotFoldersHandler)
+	router.HandleFunc("GET /rules", GetOutputRules)
+	router.HandleFunc("POST /rules", SetOutputRules)
 	router.ServeHTTP(w, r)
 }
 
 func configHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		io.SuccessJSON(w, map[string]interface{}{
-			"autoConvert":    opts.AutoConvert,
-			"deleteAfter":    opts.DeleteAfter,
-			"ignoreExisting": opts.OverwriteExisting,
-		})
+		io.SuccessJSON(w, currentConfig())
 	}
 
 	if r.Method == "POST" {
@@ -128,6 +145,14 @@ func configHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// validate before applying so a rejected request changes nothing
+		if config.Concurrency != nil {
+			if err := store.SetConcurrency(*config.Concurrency); err != nil {
+				io.ErrorJSON(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			io.Logf("Concurrency set to %d", io.Info, *config.Concurrency)
+		}
 		if config.AutoConvert != nil {
 			opts.AutoConvert = config.AutoConvert
 		}
@@ -137,15 +162,51 @@ func configHandler(w http.ResponseWriter, r *http.Request) {
 		if config.OverwriteExisting != nil {
 			opts.OverwriteExisting = config.OverwriteExisting
 		}
+
+		// let other clients update their settings
+		BroadcastMessage(types.Message{
+			MessageType: types.UpdateConfig,
+			MustSend:    true,
+			Data:        currentConfig(),
+		})
 		io.SuccessJSON(w, "success")
 	}
 }
 
+// currentConfig returns the runtime settings shared with clients
+func currentConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"autoConvert":       opts.AutoConvert,
+		"deleteAfter":       opts.DeleteAfter,
+		"ignoreExisting":    opts.OverwriteExisting,
+		"overwriteExisting": opts.OverwriteExisting,
+		"concurrency":       store.Concurrency(),
+		"running":           store.RunningConversions(),
+	}
+}
+
 func filesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	fileArray := []types.File{}
-	for _, file := range store.FileList {
+	for _, file := range store.Files() {
 		fileArray = append(fileArray, file)
 	}
 	io.SuccessJSON(w, fileArray)
 }
+
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+	file, ok := store.GetFile(r.PathValue("id"))
+	if !ok {
+		io.ErrorJSON(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if file.Media == nil {
+		io.ErrorJSON(w, "Media info not available", http.StatusNotFound)
+		return
+	}
+	io.SuccessJSON(w, file.Media)
+}
+
+func hotFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	io.SuccessJSON(w, types.ListHotFolders())
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
+	"sync"
 	"time"
 
 	"blockbuffer/internal/io"
@@ -22,6 +23,7 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+var clientsMutex = &sync.Mutex{} // guards clients and writes to their connections
 var clients = make(map[*websocket.Conn]bool)
 var broadcast = make(chan types.Message)
 var outboundMessages = make(map[string]time.Time)
@@ -36,16 +38,35 @@ func HandleSocketConnections(w http.ResponseWriter, r *http.Request) {
 	}
 
 	defer ws.Close()
+	clientsMutex.Lock()
 	clients[ws] = true
-	ws.WriteJSON(types.Message{MessageType: types.RefreshFiles, Data: store.FileList})
+	ws.WriteJSON(types.Message{MessageType: types.RefreshFiles, Data: store.Files()})
+	clientsMutex.Unlock()
 	io.Log("new socket connection established", io.Info)
 	for {
-		var messages []types.File
-		err := ws.ReadJSON(&messages)
+		var command types.Command
+		err := ws.ReadJSON(&command)
 		if err != nil {
+			clientsMutex.Lock()
 			delete(clients, ws)
+			clientsMutex.Unlock()
 			return
 		}
+
+		// job control commands, errors are only reported to the sender
+		if err := runJobAction(command.FileID, command.Command); err != nil {
+			clientsMutex.Lock()
+			ws.WriteJSON(types.Message{
+				MessageType: types.CommandError,
+				MustSend:    true,
+				Data: map[string]string{
+					"command": string(command.Command),
+					"fileId":  command.FileID,
+					"error":   err.Error(),
+				},
+			})
+			clientsMutex.Unlock()
+		}
 	}
 }
 
@@ -64,6 +85,7 @@ func HandleMessages() {
 
 		// send message to all clients, close connection if error
 		outboundMessages[hash] = time.Now()
+		clientsMutex.Lock()
 		for client := range clients {
 			err := client.WriteJSON(message)
 			if err != nil {
@@ -72,6 +94,7 @@ func HandleMessages() {
 				io.Log("socket connection closed", io.Info)
 			}
 		}
+		clientsMutex.Unlock()
 	}
 }
 
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// set the section of the source a job converts
+func setTrim(w http.ResponseWriter, r *http.Request) {
+	var trim types.Trim
+	if err := json.NewDecoder(r.Body).Decode(&trim); err != nil {
+		io.ErrorJSON(w, fmt.Sprintf("Failed to decode request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	updateTrim(w, r.PathValue("id"), &trim)
+}
+
+// convert the whole source again
+func clearTrim(w http.ResponseWriter, r *http.Request) {
+	updateTrim(w, r.PathValue("id"), nil)
+}
+
+func updateTrim(w http.ResponseWriter, fileId string, trim *types.Trim) {
+	var err error
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		// running encodes already use the previous range
+		if file.Status == types.Processing || file.Status == types.Paused {
+			err = fmt.Errorf("%w: cannot trim a %s job", types.ErrInvalidJobState, file.Status)
+			return
+		}
+		if trim != nil {
+			if err = trim.Validate(file.SourceDuration()); err != nil {
+				return
+			}
+		}
+		file.SetTrim(trim)
+	})
+	if !ok {
+		io.ErrorJSON(w, types.ErrFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		code := jobErrorCode(err)
+		if errors.Is(err, types.ErrInvalidTrim) {
+			code = http.StatusBadRequest
+		}
+		io.ErrorJSON(w, err.Error(), code)
+		return
+	}
+
+	BroadcastMessage(types.Message{
+		MessageType: types.UpdateFile,
+		MustSend:    true,
+		Data:        map[string]types.File{file.ID: file},
+	})
+	io.SuccessJSON(w, file)
+}
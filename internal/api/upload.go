@@ -11,6 +11,8 @@ import (
 
 	appIO "blockbuffer/internal/io"
 	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
 )
 
 func HandleUpload(w http.ResponseWriter, r *http.Request, deferMove bool) {
@@ -50,28 +52,59 @@ func HandleUploadMultipleFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tempFiles := []string{}
+	var trim *types.Trim // optional in/out fields applied to every uploaded file
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			removeUploads(tempFiles)
+			appIO.ErrorJSON(w, "Failed to get files", http.StatusBadRequest)
+			return
+		}
+		if name := part.FormName(); name == "in" || name == "out" {
+			if trim == nil {
+				trim = &types.Trim{}
+			}
+			if err := readTimecode(part, name, trim); err != nil {
+				removeUploads(tempFiles)
+				appIO.ErrorJSON(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			continue
+		}
 		if part.FormName() != "files" || part.FileName() == "" {
 			continue
 		}
 
 		_, tempPath, err := writeFile(part, *&multipart.FileHeader{Filename: part.FileName()})
 		if err != nil {
+			removeUploads(tempFiles)
 			appIO.ErrorJSON(w, "Failed to write file", http.StatusInternalServerError)
 			return
 		}
 		tempFiles = append(tempFiles, tempPath)
 	}
 
+	if trim != nil {
+		if err := trim.Validate(0); err != nil {
+			removeUploads(tempFiles)
+			appIO.ErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	filenames := []string{}
 	for _, tempPath := range tempFiles {
 		filename := filepath.Base(tempPath)
 		filenames = append(filenames, filename)
-		moveFile(tempPath, filepath.Join(*opts.WatchDir, filename))
+		watchPath := filepath.Join(*opts.WatchDir, filename)
+		if trim != nil {
+			// the job is created by the watcher once the file lands in the watch folder
+			store.SetPendingTrim(watchPath, *trim)
+		}
+		moveFile(tempPath, watchPath)
 	}
 
 	jsonData := json.NewEncoder(w)
@@ -79,6 +112,24 @@ func HandleUploadMultipleFiles(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// readTimecode sets the in or out point of a trim from a form field
+func readTimecode(part *multipart.Part, name string, trim *types.Trim) error {
+	value, err := io.ReadAll(io.LimitReader(part, 64))
+	if err != nil {
+		return err
+	}
+	timecode, err := types.ParseTimecode(string(value))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", types.ErrInvalidTrim, name, err)
+	}
+	if name == "in" {
+		trim.In = timecode
+	} else {
+		trim.Out = timecode
+	}
+	return nil
+}
+
 func writeFile(reader io.Reader, header multipart.FileHeader) (*os.File, string, error) {
 	tempPath := filepath.Join(*opts.UploadDir, header.Filename)
 	tempFile, err := os.Create(tempPath)
@@ -90,12 +141,20 @@ func writeFile(reader io.Reader, header multipart.FileHeader) (*os.File, string,
 
 	_, err = io.Copy(tempFile, reader)
 	if err != nil {
+		os.Remove(tempPath)
 		return nil, "", err
 	}
 
 	return tempFile, tempPath, nil
 }
 
+// removeUploads deletes uploaded files that won't be moved to the watch folder
+func removeUploads(tempPaths []string) {
+	for _, tempPath := range tempPaths {
+		os.Remove(tempPath)
+	}
+}
+
 func moveFile(tempPath string, watchFilePath string) error {
 	err := os.Rename(tempPath, watchFilePath)
 	if err != nil {
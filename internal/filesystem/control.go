@@ -0,0 +1,154 @@
+// This file handles job control requests from the API: cancelling,
+// pausing, resuming and requeueing conversions.
+package filesystem
+
+import (
+	"errors"
+	"os"
+
+	io "blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// ControlJob applies a job control action to a file
+func ControlJob(fileId string, action types.JobAction) error {
+	file, ok := store.GetFile(fileId)
+	if !ok {
+		return types.ErrFileNotFound
+	}
+
+	switch action {
+	case types.CancelJob:
+		return cancelJob(file)
+	case types.PauseJob:
+		return signalJob(file, types.Processing, types.Paused, Backend.Pause)
+	case types.ResumeJob:
+		return signalJob(file, types.Paused, types.Processing, Backend.Resume)
+	case types.RequeueJob:
+		return requeueJob(file)
+	}
+	return types.ErrUnknownAction
+}
+
+// cancelJob stops a queued or running job, completed outputs are kept
+func cancelJob(file types.File) error {
+	switch file.Status {
+	case types.Queued, types.Processing, types.Paused:
+	default:
+		return types.ErrInvalidJobState
+	}
+
+	file, ok := store.ModifyFile(file.ID, func(f *types.File) {
+		f.Outputs = append([]types.Output{}, f.Outputs...)
+		for i, output := range f.Outputs {
+			switch output.Status {
+			case types.Queued, types.Processing, types.Paused:
+				f.Outputs[i].Status = types.Cancelled
+				f.Outputs[i].Reason = types.CancelledByUser
+			}
+		}
+		if len(f.Outputs) == 0 {
+			f.Status = types.Cancelled
+		}
+		f.Summarize()
+	})
+	if !ok {
+		return types.ErrFileNotFound
+	}
+
+	// waiting jobs leave the queue, running jobs are stopped
+	store.Dequeue(file.ID)
+	CancelConversion(file.ID)
+	io.Logf("Cancelled job: %s", io.Info, file.FilePath)
+	broadcastFile(file, true)
+	return nil
+}
+
+// signalJob pauses or resumes the running conversion of a job and moves
+// the running output from one status to another
+func signalJob(file types.File, from types.FileStatus, to types.FileStatus, signal func(fileId string) error) error {
+	if file.Status != from {
+		return types.ErrInvalidJobState
+	}
+	file, err := signalConversion(file.ID, from, to, signal)
+	if err != nil {
+		return err
+	}
+	io.Logf("Job %s: %s", io.Info, to, file.FilePath)
+	broadcastFile(file, true)
+	return nil
+}
+
+// signalConversion signals the running conversion of a file while holding the
+// conversion lock, so concurrent pause and resume requests are applied in order
+// and always to the output that is being converted
+func signalConversion(fileId string, from types.FileStatus, to types.FileStatus, signal func(fileId string) error) (types.File, error) {
+	ConversionMutex.Lock()
+	defer ConversionMutex.Unlock()
+
+	conv, ok := ConversionMap[fileId]
+	if !ok {
+		return types.File{}, types.ErrInvalidJobState
+	}
+	file, ok := store.GetFile(fileId)
+	if !ok {
+		return types.File{}, types.ErrFileNotFound
+	}
+	if conv.output >= len(file.Outputs) || file.Outputs[conv.output].Status != from {
+		return types.File{}, types.ErrInvalidJobState
+	}
+	if err := signal(fileId); errors.Is(err, errNotRunning) {
+		return types.File{}, types.ErrInvalidJobState
+	} else if err != nil {
+		return types.File{}, err
+	}
+
+	file, _ = store.ModifyFile(fileId, func(f *types.File) {
+		// the output may have finished while it was signalled
+		if conv.output < len(f.Outputs) && f.Outputs[conv.output].Status == from {
+			f.Outputs = append([]types.Output{}, f.Outputs...)
+			f.Outputs[conv.output].Status = to
+		}
+		f.Summarize()
+	})
+	return file, nil
+}
+
+// requeueJob puts a finished job back in the queue, overwriting its outputs
+func requeueJob(file types.File) error {
+	switch file.Status {
+	case types.Completed, types.Failed, types.Cancelled, types.Rejected:
+	default:
+		return types.ErrInvalidJobState
+	}
+	if store.IsPending(file.ID) {
+		return types.ErrInvalidJobState
+	}
+	if _, err := os.Stat(file.FilePath); err != nil {
+		return types.ErrInvalidJobState
+	}
+
+	file, ok := store.ModifyFile(file.ID, func(f *types.File) {
+		f.Outputs = append([]types.Output{}, f.Outputs...)
+		for i := range f.Outputs {
+			f.Outputs[i].Status = types.Queued
+			f.Outputs[i].Progress = 0
+			f.Outputs[i].Error = ""
+			f.Outputs[i].Reason = ""
+			f.Outputs[i].Attempts = 0
+		}
+		f.Status = types.Queued
+		f.Progress = 0
+		f.Error = ""
+		f.Force = true
+	})
+	if !ok {
+		return types.ErrFileNotFound
+	}
+
+	io.Logf("Re-queueing job: %s", io.Info, file.FilePath)
+	broadcastFile(file, true)
+	store.Enqueue(file)
+	return nil
+}
@@ -0,0 +1,98 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+func TestCancelBeforeEncodeStarts(t *testing.T) {
+	// the job isn't queued, so only the call below converts it
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "early-cancel.mov")
+	file := types.File{ID: "early-cancel", FilePath: filepath.Join(dir, "early-cancel.mp4"), Outputs: []types.Output{{FilePath: outFile, Status: types.Cancelled}}}
+	store.UpdateFile(file)
+	t.Cleanup(func() { store.RemoveFile(file.ID) })
+
+	job := TranscodeJob{FileID: file.ID, Output: 0, InFile: file.FilePath, OutFile: outFile}
+	if err := convertWithProgress(job, 0, 1); err != errCancelled {
+		t.Errorf("got error %v, want %v", err, errCancelled)
+	}
+	if n := jobsFor(file.ID); n != 0 {
+		t.Errorf("ran %d jobs for a cancelled output, want 0", n)
+	}
+	if _, err := os.Stat(outFile); !os.IsNotExist(err) {
+		t.Errorf("cancelled output was written: %v", err)
+	}
+}
+
+func TestMissedCancelRemovesOutput(t *testing.T) {
+	file := queueSource(t, "missed-cancel.mp4", types.GetHotFolder(types.DefaultHotFolder))
+	waitFor(t, file.ID, "the conversion to start", isConverting)
+
+	// a cancel that lands before the encode is registered doesn't stop it
+	file, _ = store.ModifyFile(file.ID, func(f *types.File) {
+		f.Outputs = append([]types.Output{}, f.Outputs...)
+		f.Outputs[0].Status = types.Cancelled
+		f.Summarize()
+	})
+	waitFor(t, file.ID, "the conversion to finish", func(file types.File) bool { return !store.IsPending(file.ID) })
+
+	if _, err := os.Stat(file.Outputs[0].FilePath); !os.IsNotExist(err) {
+		t.Errorf("output of the cancelled job was kept: %v", err)
+	}
+	if current, _ := store.GetFile(file.ID); current.Status != types.Cancelled {
+		t.Errorf("job is %s, want cancelled", current.Status)
+	}
+}
+
+func TestConcurrentPauseAndResume(t *testing.T) {
+	file := queueSource(t, "pause-resume.mp4", types.GetHotFolder(types.DefaultHotFolder))
+	waitFor(t, file.ID, "the conversion to start", isConverting)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(action types.JobAction) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if err := ControlJob(file.ID, action); err != nil && !errors.Is(err, types.ErrInvalidJobState) {
+					t.Errorf("%s: %v", action, err)
+				}
+				if action == types.PauseJob {
+					action = types.ResumeJob
+				} else {
+					action = types.PauseJob
+				}
+			}
+		}([]types.JobAction{types.PauseJob, types.ResumeJob}[i%2])
+	}
+	wg.Wait()
+
+	// the reported status has to match the conversion, or a paused job
+	// could never be resumed
+	current, _ := store.GetFile(file.ID)
+	if paused, running := fakePaused(file.ID); running && paused != (current.Status == types.Paused) {
+		t.Fatalf("conversion paused = %v but job is %s", paused, current.Status)
+	}
+	if current.Status == types.Paused {
+		if err := ControlJob(file.ID, types.ResumeJob); err != nil {
+			t.Fatalf("resume: %v", err)
+		}
+	}
+	waitFor(t, file.ID, "the conversion to finish", hasStatus(types.Completed))
+}
+
+// fakePaused reports whether the fake conversion of a file is paused, and
+// whether it is still running
+func fakePaused(fileId string) (paused bool, running bool) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	run, ok := fake.running[fileId]
+	return ok && run.paused, ok
+}
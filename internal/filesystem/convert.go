@@ -1,19 +1,10 @@
-// This file handles the conversion of files to DNxHR format and
+// This file handles the conversion of files using their resolved preset and
 // communicates the progress of the conversion to the user.
 package filesystem
 
 import (
-	"encoding/json"
-	"fmt"
-	"math/rand"
-	"net"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	api "blockbuffer/internal/api"
@@ -25,27 +16,24 @@ import (
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-// var conv chan int // conv is a channel to limit the number of concurrent conversions
-var conv = make(chan int, *opts.MaxConcurrent)
-var Cmd *exec.Cmd
-
 // map file ID to Conversion command
 type Conversion struct {
 	inFile  string
 	outFile string
-	cmd     *exec.Cmd
+	output  int // index of the output being converted
 }
 
-func PollFile(inputFile string) float64 {
-	a, err := ffmpeg.Probe(inputFile)
-	io.CheckError(err)
-	err = json.Unmarshal([]byte(a), &InputProbeData)
-	io.CheckError(err)
-	totalDuration, err := ProbeDuration(InputProbeData)
-	io.CheckError(err)
-	return totalDuration
+// PollFile probes a file and returns its media info, nil if the file can't be probed
+func PollFile(inputFile string) *types.MediaInfo {
+	media, err := Backend.Probe(inputFile)
+	if err != nil {
+		io.Logf("Error probing file %s: %v", io.Error, inputFile, err)
+		return nil
+	}
+	return media
 }
 
+var ConversionMutex = &sync.Mutex{}
 var ConversionMap = make(map[string]Conversion)
 
 func Ternary(condition bool, a any, b any) any {
@@ -55,12 +43,11 @@ func Ternary(condition bool, a any, b any) any {
 	return b
 }
 
-func waitForFileReady(filePath string) bool {
-	const checkInterval = 5 * time.Second
-	const maxChecks = 10
+var readyCheckInterval = opts.MaxCheckInterval // delay between the size checks of a file that may still be written
 
+func waitForFileReady(filePath string) bool {
 	var lastSize int64 = -1
-	for i := 0; i < maxChecks; i++ {
+	for i := 0; i < opts.MaxCheckRepeat; i++ {
 		fileInfo, err := os.Stat(filePath)
 		if err != nil {
 			io.Logf("Error stating file %s: %v", io.Error, filePath, err)
@@ -73,264 +60,369 @@ func waitForFileReady(filePath string) bool {
 		}
 
 		lastSize = currentSize
-		time.Sleep(checkInterval)
+		time.Sleep(readyCheckInterval)
 	}
 
 	return false
 }
 
+// ProcessQueue takes jobs from the scheduler whenever a conversion slot is free
 func ProcessQueue() {
+	eligible := func(file types.File) bool {
+		return hotFolderOf(file).ShouldAutoConvert()
+	}
 	for {
-		for file := range store.FileQueue {
-			// if fileis in skip list, skip it
-			if !skipList[file.ID] {
-				go convertToDNxHR(file, *opts.OutputDir)
-			} else {
-				io.Logf("Skipping file: %s", io.Info, file.FilePath)
-				delete(skipList, file.FilePath) // skipped files are removed from the skip list
-			}
-		}
-
-		// sleep before retrying processQueue
-		time.Sleep(15 * time.Second)
+		// slots are only taken once there is a job, an idle queue leaves them to previews
+		store.WaitForJob(eligible)
+		store.AcquireSlot()
+		file := store.NextJob(eligible)
+		go convertFile(file)
 	}
 }
 
-type probeData struct {
-	Streams []struct {
-		Width  int `json:"width"`
-		Height int `json:"height"`
-	} `json:"streams"`
-	Format struct {
-		Duration string `json:"duration"`
-	} `json:"format"`
-}
-
-var InputProbeData = probeData{}
+// convertFile runs FFmpeg once for each of the file's outputs, the caller
+// holds a conversion slot that is freed once the file is done
+func convertFile(inputFile types.File) {
+	folder := hotFolderOf(inputFile)
 
-// convertToDNxHR runs FFmpeg to convert the video to DNxHR
-func convertToDNxHR(inputFile types.File, outputDir string) {
-	for !*opts.AutoConvert {
-		time.Sleep(2 * time.Second)
+	// jobs cancelled or removed after being picked are dropped
+	if current, ok := store.GetFile(inputFile.ID); !ok || current.Status == types.Cancelled {
+		store.Release(inputFile.ID)
+		store.ReleaseSlot()
+		return
 	}
 
-	conv <- 1
 	if !waitForFileReady(inputFile.FilePath) {
 		io.Logf("File %s is not ready to be processed", io.Info, inputFile.ID)
-		store.FileQueue <- inputFile
-		<-conv
+		store.ReturnJob(inputFile)
+		store.ReleaseSlot()
 		return
 	}
+	defer store.Release(inputFile.ID)
 
-	// Prepare paths
-	outputFile := strings.TrimSuffix(filepath.Base(inputFile.FilePath), filepath.Ext(inputFile.FilePath)) + "_dnxhr.mov"
-	outputPath := filepath.Join(outputDir, outputFile)
-	// if file exists and not overwriting, skip conversion
-	if _, err := os.Stat(outputPath); err == nil && !*opts.OverwriteExisting {
-		io.Logf("Skipping existing file: %s", io.Info, outputFile)
-		updateProgress(inputFile.ID, -10, true)
-		<-conv
+	// resolve outputs now so rules and presets assigned while queued are used
+	outputs, err := planOutputs(inputFile)
+	if err != nil {
+		io.Logf("Not converting %s: %v", io.Error, inputFile.FilePath, err)
+		failFile(inputFile.ID, err)
+		store.ReleaseSlot()
+		return
+	}
+	inputFile, ok := setOutputs(inputFile.ID, outputs)
+	if !ok {
+		store.ReleaseSlot()
 		return
 	}
 
-	// probe input file
-	if len(InputProbeData.Streams) == 0 {
-		a, err := ffmpeg.Probe(inputFile.FilePath)
-		io.CheckError(err)
-		err = json.Unmarshal([]byte(a), &InputProbeData)
-		io.CheckError(err)
+	// probe input file if it wasn't probed when queued, or changed while waiting
+	if inputFile.Media == nil || inputFile.Media.Duration == 0 {
+		if media := PollFile(inputFile.FilePath); media != nil {
+			inputFile, _ = store.ModifyFile(inputFile.ID, func(file *types.File) {
+				file.SetMedia(media)
+			})
+		}
 	}
 
-	var inputHeight = 0
-	var inputWidth = 0
+	// subtitle files may be dropped next to the source while it waits in the queue
+	inputFile, _ = store.ModifyFile(inputFile.ID, func(file *types.File) {
+		file.Subtitles = findSubtitleFiles(file.FilePath)
+	})
+
+	var retryAfter time.Duration // longest backoff of the outputs scheduled for a retry
+	for i, output := range inputFile.Outputs {
+		// outputs may have been cancelled while earlier outputs were converting
+		if current, ok := store.GetFile(inputFile.ID); !ok || current.Outputs[i].Status != types.Queued {
+			continue
+		}
+
+		// if file exists and not overwriting, skip conversion
+		if _, err := os.Stat(output.FilePath); err == nil && !*opts.OverwriteExisting && !inputFile.Force {
+			io.Logf("Skipping existing file: %s", io.Info, output.FilePath)
+			updateProgress(inputFile.ID, i, -10, true)
+			continue
+		}
 
-	// find width / height of video stream
-	if inputWidth == 0 {
-		for _, stream := range InputProbeData.Streams {
-			if stream.Width != 0 && stream.Height != 0 {
-				inputWidth = stream.Width
-				inputHeight = stream.Height
-				break
+		if err := os.MkdirAll(output.OutputDir, 0755); err != nil {
+			io.Logf("Failed to create output directory: %v", io.Error, err)
+			if backoff, retry := handleFailure(inputFile.ID, i, err); retry && backoff > retryAfter {
+				retryAfter = backoff
 			}
+			continue
 		}
-	}
 
-	// create ffmpeg args
-	ffmpegArgs := ffmpeg.KwArgs{}
-	// convert EncoderProfile to ffmpeg.KwArgs
-	var profile = types.DefaultPreset
-	ffmpegArgs["c:v"] = profile.VideoPreset.Codec
-	ffmpegArgs["pix_fmt"] = profile.VideoPreset.Format
-	ffmpegArgs["c:a"] = profile.AudioPreset.Codec
-	if profile.VideoPreset.Options != nil {
-		for _, opt := range *profile.VideoPreset.Options {
-			ffmpegArgs[opt.Name] = opt.Value
+		err := encodeOutput(inputFile, i, output)
+		if current, ok := store.GetFile(inputFile.ID); ok && current.Outputs[i].Status == types.Cancelled {
+			io.Logf("Cancelled conversion: %s -> %s", io.Info, inputFile.FilePath, output.FilePath)
+			// a cancel that found no running encode lets it finish, the output is removed either way
+			removeOutput(output)
+			continue
 		}
-	}
-	if profile.AudioPreset.Options != nil {
-		for _, opt := range *profile.AudioPreset.Options {
-			ffmpegArgs[opt.Name] = opt.Value
+		if err != nil {
+			removeOutput(output)
+			if backoff, retry := handleFailure(inputFile.ID, i, err); retry && backoff > retryAfter {
+				retryAfter = backoff
+			}
+			continue
 		}
+		updateProgress(inputFile.ID, i, 100, true)
+		io.Logf("Successfully converted: %s -> %s", io.Info, inputFile.FilePath, output.FilePath)
 	}
 
-	// set resolution
-	if inputWidth > inputHeight && inputHeight > 1080 {
-		ffmpegArgs["vf"] = "scale=-2:1080"
-	} else if inputHeight >= inputWidth && inputWidth > 1080 {
-		ffmpegArgs["vf"] = "scale=1080:-2"
+	if retryAfter > 0 {
+		scheduleRetry(inputFile.ID, retryAfter)
 	}
 
-	io.Logf("ffmpeg args: %v", io.Info, ffmpegArgs)
-
-	convertWithProgress(inputFile.ID, inputFile.FilePath, outputPath, ffmpegArgs)
-	updateProgress(inputFile.ID, 100, true)
-	if *opts.DeleteAfter {
+	// only remove the source once every output has been written
+	if current, ok := store.GetFile(inputFile.ID); ok && current.Status == types.Completed && folder.ShouldDeleteAfter() {
 		_, err := os.Stat(inputFile.FilePath)
 		if err == nil {
+			setStatus(inputFile.ID, types.CompleteDeleted)
 			os.Remove(inputFile.FilePath)
 		}
 	}
 
-	io.Logf("Successfully converted: %s -> %s", io.Info, inputFile.FilePath, outputPath)
-	<-conv
+	store.ReleaseSlot()
 }
 
-// convertWithProgress uses the ffmpeg `-progress` option with a unix-domain socket to report progress
-func convertWithProgress(fileId string, inFileName string, outFileName string, ffmpegArgs ffmpeg.KwArgs) {
-	var err error
-
-	// get duration of video (3 seconds if preview mode)
-	totalDuration, err := ProbeDuration(InputProbeData)
-	io.CheckError(err)
-
-	io.Logf("Processing file: %s", io.Info, inFileName)
-	Cmd = ffmpeg.Input(inFileName).
-		Output(outFileName, ffmpegArgs).
-		GlobalArgs("-progress", "unix://"+TempSock(totalDuration, fileId)).
-		OverWriteOutput().
-		Silent(true).
-		Compile()
-	ConversionMap[fileId] = Conversion{
-		inFile:  inFileName,
-		outFile: outFileName,
-		cmd:     Cmd,
+// encodeOutput converts one output with the first usable encoder candidates of
+// its preset, moving on to the next candidate when an encoder fails to open
+func encodeOutput(inputFile types.File, i int, output types.Output) error {
+	profile, _ := types.GetPreset(output.Preset)
+	if err := checkStreams(profile, inputFile.Media); err != nil {
+		return err
 	}
+	profile = cropPreset(profile, inputFile)
+	for {
+		videoCodec, audioCodec, err := resolveEncoders(profile)
+		if err != nil {
+			return err
+		}
+		recordEncoders(inputFile.ID, i, videoCodec, audioCodec)
 
-	err = Cmd.Run()
-	if err != nil {
-		io.Logf("Error converting file: %s: %v", io.Error, inFileName, err)
+		// create ffmpeg args from the preset
+		ffmpegArgs := presetArgs(profile, videoCodec, audioCodec)
+		if err := streamArgs(profile, inputFile.Media, inputFile.Trim, ffmpegArgs); err != nil {
+			return err
+		}
+		// set the preset filters and the resolution from the scale rule and the probed source size
+		filterArgs(profile, inputFile.Media, ffmpegArgs)
+
+		if profile.Packaging != nil {
+			err = runPackage(inputFile, i, output, profile, ffmpegArgs)
+		} else {
+			var subtitles []string
+			if subtitles, err = subtitleArgs(profile, inputFile, inputFile.Trim, ffmpegArgs); err != nil {
+				return err
+			}
+			err = runPasses(inputFile, i, output, profile, videoCodec, ffmpegArgs, subtitles)
+			if err == nil && profile.Subtitles != nil && profile.Subtitles.Mode == types.SubtitleSidecar {
+				err = writeSubtitleSidecars(inputFile, i, output, profile)
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if current, ok := store.GetFile(inputFile.ID); !ok || current.Outputs[i].Status == types.Cancelled {
+			return err
+		}
+		if !markFailedEncoders(videoCodec, audioCodec, err) {
+			return err
+		}
+		removeOutput(output)
 	}
-
-	defer CancelConversion(fileId)
-	io.Logf("Successfully queued file: %s -> %s", io.Info, inFileName, outFileName)
 }
 
-func ProbeDuration(data probeData) (float64, error) {
-	f, err := strconv.ParseFloat(data.Format.Duration, 64)
-	if err != nil {
-		return 0, err
+// runPasses encodes an output in one or two passes depending on the preset rate control
+func runPasses(inputFile types.File, i int, output types.Output, profile types.PresetBundle, videoCodec string, ffmpegArgs ffmpeg.KwArgs, subtitles []string) error {
+	passLog := ""
+	if profile.VideoPreset.Rate.TwoPass() {
+		var err error
+		if passLog, err = passLogPrefix(inputFile.ID, i); err != nil {
+			return err
+		}
+		defer removePassLogs(passLog)
 	}
-	return f, nil
-}
 
-func TempSock(totalDuration float64, fileId string) string {
-	// serve
-	sockFileName := path.Join(os.TempDir(), fmt.Sprintf("%d_sock", rand.Int()))
-	l, err := net.Listen("unix", sockFileName)
+	inputArgs := trimArgs(inputFile, ffmpegArgs)
+	passes, err := ratePasses(profile, inputFile.Media, inputFile.Duration, videoCodec, ffmpegArgs, output.FilePath, passLog)
 	if err != nil {
-		updateProgress(fileId, -1, true)
-		panic(err)
+		return err
 	}
-
-	go func() {
-		re := regexp.MustCompile(`out_time_ms=(\d+)`)
-		fd, err := l.Accept()
-		if err != nil {
-			io.Logf("Error accepting connection: %v", io.Fatal, err)
+	for pass, p := range passes {
+		io.Logf("Converting %s with preset %s (pass %d/%d), ffmpeg args: %v", io.Info, inputFile.FilePath, profile.Name, pass+1, len(passes), p.args)
+		job := TranscodeJob{
+			FileID:    inputFile.ID,
+			Output:    i,
+			InFile:    inputFile.FilePath,
+			OutFile:   p.outFile,
+			InputArgs: inputArgs,
+			Subtitles: subtitles,
+			Args:      p.args,
+			Duration:  inputFile.Duration,
 		}
-		buf := make([]byte, 16)
-		data := ""
-		for {
-			_, err := fd.Read(buf)
-			if err != nil {
-				return
-			}
-			data += string(buf)
-			a := re.FindAllStringSubmatch(data, -1)
-			cp := 0.00
-			if len(a) > 0 && len(a[len(a)-1]) > 0 {
-				c, _ := strconv.Atoi(a[len(a)-1][len(a[len(a)-1])-1])
-				cp = float64(c) / totalDuration / 1000000
-			}
-			if strings.Contains(data, "progress=end") {
-				cp = 1.00
-				updateProgress(fileId, 100, true)
-				break
-			}
-			if cp > 0.00 && cp <= 1.00 {
-				updateProgress(fileId, float32(cp*100), false)
-				if cp == 1.00 {
-					l.Close()
-					break
-				}
-			}
+		if err := convertWithProgress(job, pass, len(passes)); err != nil {
+			return err
 		}
-	}()
+		// a job cancelled between passes doesn't start the next pass
+		if current, ok := store.GetFile(inputFile.ID); !ok || current.Outputs[i].Status == types.Cancelled {
+			return errCancelled
+		}
+	}
+	return nil
+}
 
-	return sockFileName
+// trimArgs limits the output to the trim range of a job and returns the input
+// arguments, trimmed jobs seek accurately to the in point; without an out
+// point or a known length the output runs to the end of the source
+func trimArgs(inputFile types.File, ffmpegArgs ffmpeg.KwArgs) ffmpeg.KwArgs {
+	inputArgs := ffmpeg.KwArgs{}
+	if inputFile.Trim != nil {
+		inputArgs["ss"] = inputFile.Trim.In.String()
+		if inputFile.Trim.Out > 0 && inputFile.Duration > 0 {
+			ffmpegArgs["t"] = types.Timecode(inputFile.Duration).String()
+		}
+	}
+	return inputArgs
 }
 
-func updateProgress(fileId string, progress float32, mustSend bool) {
-	file, ok := store.FileList[fileId]
-	if !ok {
-		return
+// convertWithProgress runs one pass of an output through the transcoder
+// backend and forwards the progress combined across passes to the user
+func convertWithProgress(job TranscodeJob, pass int, passes int) error {
+	io.Logf("Processing file: %s", io.Info, job.InFile)
+	ConversionMutex.Lock()
+	ConversionMap[job.FileID] = Conversion{
+		inFile:  job.InFile,
+		outFile: job.OutFile,
+		output:  job.Output,
 	}
-	status := file.Status
+	ConversionMutex.Unlock()
+	defer func() {
+		ConversionMutex.Lock()
+		delete(ConversionMap, job.FileID)
+		ConversionMutex.Unlock()
+	}()
+
+	// a cancel that arrived while the job was prepared had no conversion to stop
+	if current, ok := store.GetFile(job.FileID); !ok || job.Output >= len(current.Outputs) || current.Outputs[job.Output].Status == types.Cancelled {
+		return errCancelled
+	}
+	return Backend.Run(job, func(progress float32) {
+		updateProgress(job.FileID, job.Output, (float32(pass)*100+progress)/float32(passes), false)
+	})
+}
+
+// updateProgress records the progress of one output and broadcasts the updated file
+func updateProgress(fileId string, output int, progress float32, mustSend bool) {
+	status := types.Processing
 	switch progress {
 	case -10:
 		status = types.Rejected
-		break
 	case -1:
 		status = types.Failed
-		break
 	case 100:
-		status = Ternary(*opts.DeleteAfter, types.CompleteDeleted, types.Completed).(types.FileStatus)
-		break
-	default:
-		status = types.Processing
-		break
+		status = types.Completed
 	}
 
-	store.FileListMutex.Lock()
-	store.FileList[fileId] = types.File{
-		ID:       fileId,
-		FilePath: file.FilePath,
-		Status:   status,
-		Duration: file.Duration,
-		Progress: progress,
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		if output < 0 || output >= len(file.Outputs) {
+			return
+		}
+
+		// late progress reports must not revive finished outputs or
+		// resume paused ones
+		current := file.Outputs[output].Status
+		if current == types.Cancelled {
+			return
+		}
+		if status == types.Processing {
+			switch current {
+			case types.Completed, types.Failed, types.Rejected:
+				return
+			case types.Paused:
+				status = types.Paused
+			}
+		}
+
+		// copy outputs so readers holding the previous file aren't mutated
+		file.Outputs = append([]types.Output{}, file.Outputs...)
+		file.Outputs[output].Status = status
+		if progress >= 0 {
+			file.Outputs[output].Progress = progress
+		}
+		file.Summarize()
+	})
+	if ok {
+		broadcastFile(file, mustSend)
+	}
+}
+
+// setOutputs replaces the planned outputs of a file, keeping outputs completed
+// by an earlier run and the attempts of retried ones, false if the file is no
+// longer tracked
+func setOutputs(fileId string, outputs []types.Output) (types.File, bool) {
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		for i, output := range outputs {
+			for _, prev := range file.Outputs {
+				if prev.FilePath != output.FilePath {
+					continue
+				}
+				if prev.Status == types.Completed {
+					outputs[i] = prev
+				} else {
+					outputs[i].Attempts, outputs[i].Reason, outputs[i].Error = prev.Attempts, prev.Reason, prev.Error
+				}
+			}
+		}
+		file.Outputs = outputs
+		file.Summarize()
+	})
+	if ok {
+		broadcastFile(file, true)
 	}
-	store.FileListMutex.Unlock()
+	return file, ok
+}
 
+// failFile marks a file that can't be converted at all as failed, its
+// outputs are dropped as none of them can be written
+func failFile(fileId string, err error) {
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		file.Outputs = []types.Output{}
+		file.Status = types.Failed
+		file.Error = err.Error()
+	})
+	if ok {
+		broadcastFile(file, true)
+	}
+}
+
+// setStatus overrides the status of a file and broadcasts the change
+func setStatus(fileId string, status types.FileStatus) {
+	file, ok := store.ModifyFile(fileId, func(file *types.File) {
+		file.Status = status
+	})
+	if ok {
+		broadcastFile(file, true)
+	}
+}
+
+func broadcastFile(file types.File, mustSend bool) {
 	api.BroadcastMessage(types.Message{
 		MessageType: types.UpdateFile,
 		MustSend:    mustSend,
 		Data: map[string]types.File{
-			fileId: store.FileList[fileId],
+			file.ID: file,
 		},
 	})
 }
 
+// CancelConversion stops the running conversion of a file
 func CancelConversion(fileId string) {
-	if conv, ok := ConversionMap[fileId]; ok {
+	ConversionMutex.Lock()
+	_, ok := ConversionMap[fileId]
+	delete(ConversionMap, fileId)
+	ConversionMutex.Unlock()
+	if ok {
 		io.Logf("Cancelling conversion: %s", io.Info, fileId)
-		if err := conv.cmd.Process.Signal(os.Interrupt); err == nil {
-			if _, err := os.Stat(conv.outFile); !os.IsNotExist(err) {
-				io.Logf("Removing incomplete file: %s", io.Info, conv.outFile)
-				if err := os.Remove(conv.outFile); err != nil {
-					io.Logf("Error deleting file: %v", io.Error, err)
-				}
-			}
-		}
-		delete(ConversionMap, fileId)
+		Backend.Cancel(fileId)
 	}
 }
@@ -0,0 +1,281 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	api "blockbuffer/internal/api"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const testTimeout = 10 * time.Second
+
+var fake *FakeTranscoder
+
+// TestMain runs the conversion queue against the fake transcoder, with the
+// hot folder and data directories in a temporary directory
+func TestMain(m *testing.M) {
+	// loading the presets at init writes a blank config next to the tests
+	if data, err := os.ReadFile(*opts.PresetConfigPath); err == nil && string(data) == `{"presets":[]}` {
+		os.Remove(*opts.PresetConfigPath)
+	}
+
+	dir, err := os.MkdirTemp("", "blockbuffer")
+	if err != nil {
+		panic(err)
+	}
+	*opts.PresetConfigPath = filepath.Join(dir, "presets.json")
+	*opts.WatchDir = filepath.Join(dir, "input")
+	*opts.OutputDir = filepath.Join(dir, "output")
+	*opts.DataDir = filepath.Join(dir, "data")
+	*opts.MaxRetries = 1
+	*opts.RetryBackoff = 0
+	for _, path := range []string{*opts.WatchDir, *opts.OutputDir, *opts.DataDir} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			panic(err)
+		}
+	}
+	readyCheckInterval = 10 * time.Millisecond
+
+	fake = NewFakeTranscoder()
+	fake.Steps = 10
+	fake.StepDelay = 20 * time.Millisecond
+	fake.Failures = map[string]string{
+		"diskfull":   "av_interleaved_write_frame(): No space left on device",
+		"unreadable": "moov atom not found",
+	}
+	Backend = fake
+
+	go api.HandleMessages()
+	go ProcessQueue()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// queueSource writes a source file to a hot folder and queues its job
+func queueSource(t *testing.T, name string, folder types.HotFolder) types.File {
+	t.Helper()
+	path := filepath.Join(folder.WatchDir, name)
+	if err := os.WriteFile(path, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := newFile(path, folder)
+	store.UpdateFile(file)
+	if !store.Enqueue(file) {
+		t.Fatalf("%s was not queued", name)
+	}
+	t.Cleanup(func() { store.RemoveFile(file.ID) })
+	return file
+}
+
+// waitFor polls a file until the condition holds and returns it
+func waitFor(t *testing.T, fileId string, what string, cond func(types.File) bool) types.File {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		file, ok := store.GetFile(fileId)
+		if ok && cond(file) {
+			return file
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, file is %s: %+v", what, file.Status, file.Outputs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasStatus(status types.FileStatus) func(types.File) bool {
+	return func(file types.File) bool { return file.Status == status }
+}
+
+func isConverting(file types.File) bool {
+	return file.Status == types.Processing && file.Progress > 0
+}
+
+func jobsFor(fileId string) int {
+	count := 0
+	for _, job := range fake.Jobs() {
+		if job.FileID == fileId {
+			count++
+		}
+	}
+	return count
+}
+
+func TestConvertCompletes(t *testing.T) {
+	file := queueSource(t, "complete.mp4", types.GetHotFolder(types.DefaultHotFolder))
+	file = waitFor(t, file.ID, "completion", hasStatus(types.Completed))
+
+	if len(file.Outputs) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(file.Outputs))
+	}
+	output := file.Outputs[0]
+	if output.Status != types.Completed || output.Progress != 100 {
+		t.Errorf("output is %s at %v%%, want completed at 100%%", output.Status, output.Progress)
+	}
+	if _, err := os.Stat(output.FilePath); err != nil {
+		t.Errorf("output was not written: %v", err)
+	}
+	if n := jobsFor(file.ID); n != 1 {
+		t.Errorf("ran %d jobs, want 1", n)
+	}
+}
+
+func TestConvertFailures(t *testing.T) {
+	tests := []struct {
+		source   string
+		reason   types.FailureReason
+		attempts int // transient failures are retried up to --max-retries times
+	}{
+		{"diskfull.mp4", types.DiskFull, 2},
+		{"unreadable.mp4", types.InputUnreadable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			file := queueSource(t, tt.source, types.GetHotFolder(types.DefaultHotFolder))
+			file = waitFor(t, file.ID, "the final failure", func(file types.File) bool {
+				return file.Status == types.Failed && !store.IsPending(file.ID) && file.Outputs[0].Attempts == tt.attempts
+			})
+
+			output := file.Outputs[0]
+			if output.Reason != tt.reason {
+				t.Errorf("got reason %s, want %s", output.Reason, tt.reason)
+			}
+			if file.Error == "" {
+				t.Error("the error of the failure was not recorded")
+			}
+			if n := jobsFor(file.ID); n != tt.attempts {
+				t.Errorf("ran %d jobs, want %d", n, tt.attempts)
+			}
+			if _, err := os.Stat(output.FilePath); !os.IsNotExist(err) {
+				t.Errorf("failed output was not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCancelConversion(t *testing.T) {
+	file := queueSource(t, "cancel.mp4", types.GetHotFolder(types.DefaultHotFolder))
+	waitFor(t, file.ID, "the conversion to start", isConverting)
+
+	if err := ControlJob(file.ID, types.CancelJob); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	file = waitFor(t, file.ID, "the conversion to stop", func(file types.File) bool {
+		return file.Status == types.Cancelled && !store.IsPending(file.ID)
+	})
+
+	if reason := file.Outputs[0].Reason; reason != types.CancelledByUser {
+		t.Errorf("got reason %s, want %s", reason, types.CancelledByUser)
+	}
+	if _, err := os.Stat(file.Outputs[0].FilePath); !os.IsNotExist(err) {
+		t.Errorf("cancelled output was not removed: %v", err)
+	}
+	if err := ControlJob(file.ID, types.CancelJob); err != types.ErrInvalidJobState {
+		t.Errorf("cancelling again returned %v, want %v", err, types.ErrInvalidJobState)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	file := queueSource(t, "pause.mp4", types.GetHotFolder(types.DefaultHotFolder))
+	waitFor(t, file.ID, "the conversion to start", isConverting)
+
+	if err := ControlJob(file.ID, types.PauseJob); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	paused := waitFor(t, file.ID, "the pause", hasStatus(types.Paused))
+	time.Sleep(5 * fake.StepDelay)
+	if file, _ := store.GetFile(file.ID); file.Status != types.Paused || file.Progress != paused.Progress {
+		t.Fatalf("paused conversion moved on: %s at %v%%, paused at %v%%", file.Status, file.Progress, paused.Progress)
+	}
+	if err := ControlJob(file.ID, types.PauseJob); err != types.ErrInvalidJobState {
+		t.Errorf("pausing again returned %v, want %v", err, types.ErrInvalidJobState)
+	}
+
+	if err := ControlJob(file.ID, types.ResumeJob); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	file = waitFor(t, file.ID, "completion", hasStatus(types.Completed))
+	if n := jobsFor(file.ID); n != 1 {
+		t.Errorf("ran %d jobs, want the paused job to continue", n)
+	}
+}
+
+func TestConvertMultipleOutputs(t *testing.T) {
+	dir := t.TempDir()
+	folder := types.HotFolder{
+		Name:      "multi",
+		WatchDir:  filepath.Join(dir, "input"),
+		OutputDir: filepath.Join(dir, "output"),
+		Presets:   []string{"DNxHR", "MP4"},
+	}
+	if err := os.MkdirAll(folder.WatchDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	types.HotFoldersMutex.Lock()
+	types.HotFolders = append(types.HotFolders, folder)
+	types.HotFoldersMutex.Unlock()
+	t.Cleanup(func() {
+		types.HotFoldersMutex.Lock()
+		types.HotFolders = nil
+		types.HotFoldersMutex.Unlock()
+	})
+
+	file := queueSource(t, "multi.mp4", folder)
+	file = waitFor(t, file.ID, "completion", hasStatus(types.Completed))
+
+	want := []string{"multi_dnxhr.mov", "multi_mp4.mp4"}
+	if len(file.Outputs) != len(want) {
+		t.Fatalf("got %d outputs, want %d", len(file.Outputs), len(want))
+	}
+	for i, output := range file.Outputs {
+		if output.Preset != folder.Presets[i] || output.FilePath != filepath.Join(folder.OutputDir, want[i]) {
+			t.Errorf("output %d is %s with %s, want %s with %s", i, output.FilePath, output.Preset, want[i], folder.Presets[i])
+		}
+		if output.Status != types.Completed {
+			t.Errorf("output %d is %s, want completed", i, output.Status)
+		}
+		if _, err := os.Stat(output.FilePath); err != nil {
+			t.Errorf("output %d was not written: %v", i, err)
+		}
+	}
+	if n := jobsFor(file.ID); n != len(want) {
+		t.Errorf("ran %d jobs, want %d", n, len(want))
+	}
+}
+
+func TestTrimArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		trim      *types.Trim
+		duration  float64
+		wantInput ffmpeg.KwArgs
+		wantT     any // nil when the output runs to the end of the source
+	}{
+		{"untrimmed", nil, 60, ffmpeg.KwArgs{}, nil},
+		{"range", &types.Trim{In: 10, Out: 20}, 10, ffmpeg.KwArgs{"ss": "00:00:10.000"}, "00:00:10.000"},
+		{"in point only", &types.Trim{In: 10}, 50, ffmpeg.KwArgs{"ss": "00:00:10.000"}, nil},
+		{"in point of an unprobed source", &types.Trim{In: 10}, 0, ffmpeg.KwArgs{"ss": "00:00:10.000"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := ffmpeg.KwArgs{}
+			input := trimArgs(types.File{Trim: tt.trim, Duration: tt.duration}, args)
+			if !reflect.DeepEqual(input, tt.wantInput) {
+				t.Errorf("input args = %v, want %v", input, tt.wantInput)
+			}
+			if args["t"] != tt.wantT {
+				t.Errorf("t = %v, want %v", args["t"], tt.wantT)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// This file detects the black bars of letterboxed sources and crops them from
+// the outputs of presets with auto-crop.
+package filesystem
+
+import (
+	"fmt"
+	"sync"
+
+	io "blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const cropSegments = 5        // sections spread over the source analysed by crop detection
+const cropSegmentLength = 2.0 // seconds analysed per section
+const cropEdgeMargin = 0.05   // fraction of the source skipped at each end, e.g. black intros and credits
+
+// cropDetection is a crop detection in progress, callers asking for the crop
+// of the same job wait for it instead of running their own
+type cropDetection struct {
+	done chan struct{}
+	crop types.Crop
+	err  error
+}
+
+var cropDetectionsMutex = &sync.Mutex{}
+var cropDetections = make(map[string]*cropDetection) // file ID to running detection
+
+// DetectCrop runs crop detection over a file and stores the detected crop on
+// the job, blocking until every section is analysed; a detection already
+// running for the job is waited for
+func DetectCrop(fileId string) (types.Crop, error) {
+	cropDetectionsMutex.Lock()
+	if running, ok := cropDetections[fileId]; ok {
+		cropDetectionsMutex.Unlock()
+		<-running.done
+		return running.crop, running.err
+	}
+	detection := &cropDetection{done: make(chan struct{})}
+	cropDetections[fileId] = detection
+	cropDetectionsMutex.Unlock()
+
+	detection.crop, detection.err = detectAndStoreCrop(fileId)
+	cropDetectionsMutex.Lock()
+	delete(cropDetections, fileId)
+	cropDetectionsMutex.Unlock()
+	close(detection.done)
+	return detection.crop, detection.err
+}
+
+func detectAndStoreCrop(fileId string) (types.Crop, error) {
+	file, ok := store.GetFile(fileId)
+	if !ok {
+		return types.Crop{}, types.ErrFileNotFound
+	}
+	media := file.Media
+	if media == nil {
+		var err error
+		if media, err = Backend.Probe(file.FilePath); err != nil {
+			return types.Crop{}, err
+		}
+	}
+	rect, err := detectCrop(file.FilePath, media)
+	if err != nil {
+		return types.Crop{}, err
+	}
+
+	updated, ok := store.ModifyFile(fileId, func(file *types.File) {
+		crop := types.Crop{}
+		if file.Crop != nil {
+			crop = *file.Crop
+		}
+		crop.Detected = &rect
+		file.Crop = &crop
+	})
+	if !ok {
+		return types.Crop{}, types.ErrFileNotFound
+	}
+	broadcastFile(updated, true)
+	io.Logf("Detected crop of %s: %dx%d at %d,%d", io.Info, file.FilePath, rect.Width, rect.Height, rect.X, rect.Y)
+	return *updated.Crop, nil
+}
+
+// detectCrop analyses sections spread over the source and returns the
+// rectangle holding the picture of all of them, so a dark scene can't crop
+// the picture of a bright one
+func detectCrop(filePath string, media *types.MediaInfo) (types.CropRect, error) {
+	if media.Video() == nil {
+		return types.CropRect{}, fmt.Errorf("%w: the source has no video stream", types.ErrInvalidCrop)
+	}
+
+	var union *types.CropRect
+	for i := 0; i < cropSegments; i++ {
+		start := 0.0
+		if media.Duration > cropSegmentLength {
+			span := media.Duration * (1 - 2*cropEdgeMargin)
+			start = media.Duration*cropEdgeMargin + span*float64(i)/cropSegments
+			start = min(start, media.Duration-cropSegmentLength)
+		}
+		rect, err := Backend.DetectCrop(CropJob{
+			InFile:    filePath,
+			InputArgs: ffmpeg.KwArgs{"ss": types.Timecode(start).String()},
+			Duration:  cropSegmentLength,
+		})
+		if err != nil {
+			return types.CropRect{}, err
+		}
+		union = unionCrop(union, rect)
+		if media.Duration <= cropSegmentLength {
+			break
+		}
+	}
+	return *union, nil
+}
+
+// unionCrop returns the smallest rectangle holding both crops
+func unionCrop(a *types.CropRect, b types.CropRect) *types.CropRect {
+	if a == nil {
+		return &b
+	}
+	x, y := min(a.X, b.X), min(a.Y, b.Y)
+	right, bottom := max(a.X+a.Width, b.X+b.Width), max(a.Y+a.Height, b.Y+b.Height)
+	return &types.CropRect{Width: right - x, Height: bottom - y, X: x, Y: y}
+}
+
+// detectCropInBackground detects the crop of a file queued for a preset with
+// auto-crop, so the crop can be checked and overridden before encoding starts
+func detectCropInBackground(file types.File) {
+	if file.Crop.Rect() != nil || file.Media.Video() == nil || !needsCrop(file) {
+		return
+	}
+	go func() {
+		// crop detection decodes the source like the previews do, so they share slots
+		previewSlots <- struct{}{}
+		defer func() { <-previewSlots }()
+
+		if current, ok := store.GetFile(file.ID); !ok || current.Crop.Rect() != nil {
+			return
+		}
+		if _, err := DetectCrop(file.ID); err != nil {
+			io.Logf("Error detecting crop of %s: %v", io.Warn, file.FilePath, err)
+		}
+	}()
+}
+
+// needsCrop reports whether one of the outputs of a file uses a preset with auto-crop
+func needsCrop(file types.File) bool {
+	for _, output := range file.Outputs {
+		if preset, ok := types.GetPreset(output.Preset); ok && preset.VideoPreset.AutoCrop {
+			return true
+		}
+	}
+	return false
+}
+
+// cropPreset puts the crop of a job ahead of the filters of a preset with
+// auto-crop, detecting the crop first when it is unknown; a failed detection
+// leaves the output uncropped
+func cropPreset(preset types.PresetBundle, file types.File) types.PresetBundle {
+	video := file.Media.Video()
+	if !preset.VideoPreset.AutoCrop || preset.AudioOnly() || video == nil {
+		return preset
+	}
+	// the crop may be detected or overridden after the file was read
+	if current, ok := store.GetFile(file.ID); ok {
+		file.Crop = current.Crop
+	}
+	rect := file.Crop.Rect()
+	if rect == nil {
+		crop, err := DetectCrop(file.ID)
+		if err != nil {
+			io.Logf("Error detecting crop of %s, encoding uncropped: %v", io.Warn, file.FilePath, err)
+			return preset
+		}
+		rect = crop.Rect()
+	}
+	if rect.Covers(video.DisplaySize()) {
+		return preset
+	}
+	preset.VideoPreset.Filters = append([]types.Filter{rect.Filter()}, preset.VideoPreset.Filters...)
+	return preset
+}
@@ -0,0 +1,37 @@
+package filesystem
+
+import (
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestUnionCrop(t *testing.T) {
+	tests := []struct {
+		name string
+		a    *types.CropRect
+		b    types.CropRect
+		want types.CropRect
+	}{
+		{"first sample", nil, types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}},
+		{"same crop", &types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}},
+		{"contained crop", &types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, types.CropRect{Width: 1440, Height: 600, X: 240, Y: 240}, types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}},
+		{"letterbox and pillarbox", &types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, types.CropRect{Width: 1440, Height: 1080, X: 240, Y: 0}, types.CropRect{Width: 1920, Height: 1080, X: 0, Y: 0}},
+		{"offset crops", &types.CropRect{Width: 100, Height: 100, X: 10, Y: 20}, types.CropRect{Width: 100, Height: 100, X: 50, Y: 0}, types.CropRect{Width: 140, Height: 120, X: 10, Y: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before types.CropRect
+			if tt.a != nil {
+				before = *tt.a
+			}
+			got := unionCrop(tt.a, tt.b)
+			if got == nil || *got != tt.want {
+				t.Errorf("unionCrop() = %+v, want %+v", got, tt.want)
+			}
+			if tt.a != nil && *tt.a != before {
+				t.Error("unionCrop modified the first crop")
+			}
+		})
+	}
+}
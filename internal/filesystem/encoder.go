@@ -0,0 +1,110 @@
+// This file picks the encoders a preset runs with from its candidate lists
+// and falls back to the next candidate when an encoder fails to open.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	io "blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+// errNoEncoder is returned when none of the encoder candidates of a preset can be used
+var errNoEncoder = errors.New("no usable encoder")
+
+// resolveEncoders picks the video and audio encoder of a preset, the audio
+// encoder is empty when the preset leaves it to ffmpeg
+func resolveEncoders(preset types.PresetBundle) (string, string, error) {
+	video, ok := preset.VideoPreset.Codec.Resolve(types.Video)
+	if !ok && len(preset.VideoPreset.Codec) > 0 {
+		return "", "", fmt.Errorf("%w: video encoders %s are not available", errNoEncoder, preset.VideoPreset.Codec)
+	}
+	audio, ok := preset.AudioPreset.Codec.Resolve(types.Audio)
+	if !ok && len(preset.AudioPreset.Codec) > 0 {
+		return "", "", fmt.Errorf("%w: audio encoders %s are not available", errNoEncoder, preset.AudioPreset.Codec)
+	}
+	return video, audio, nil
+}
+
+// recordEncoders stores the encoders an output is converted with
+func recordEncoders(fileId string, output int, video string, audio string) {
+	store.ModifyFile(fileId, func(file *types.File) {
+		if output < 0 || output >= len(file.Outputs) {
+			return
+		}
+		file.Outputs = append([]types.Output{}, file.Outputs...)
+		file.Outputs[output].VideoEncoder = video
+		file.Outputs[output].AudioEncoder = audio
+	})
+}
+
+// markFailedEncoders marks the encoders blamed for a failed conversion as
+// unavailable so the next candidate is used, false if none were marked
+func markFailedEncoders(video string, audio string, err error) bool {
+	if classifyFailure(err) != types.EncoderMissing {
+		return false
+	}
+
+	type candidate struct {
+		name    string
+		encType types.EncoderType
+	}
+	var candidates []candidate
+	for _, c := range []candidate{{video, types.Video}, {audio, types.Audio}} {
+		if c.name != "" && c.name != types.CopyCodec {
+			candidates = append(candidates, c)
+		}
+	}
+
+	// only the encoders named in the error are blamed, a device error that
+	// names no encoder is blamed on the hardware candidates
+	msg := failureMessage(err)
+	blamed := slices.DeleteFunc(slices.Clone(candidates), func(c candidate) bool { return !namesEncoder(msg, c.name) })
+	if len(blamed) == 0 && containsAny(msg, deviceErrors) {
+		blamed = slices.DeleteFunc(candidates, func(c candidate) bool { return !types.IsHardwareEncoder(c.name) })
+	}
+
+	marked := false
+	for _, c := range blamed {
+		if types.MarkUnavailable(c.name, c.encType, "failed to open: "+err.Error()) {
+			io.Logf("Encoder %s failed to open, using the next candidate", io.Warn, c.name)
+			marked = true
+		}
+	}
+	return marked
+}
+
+// namesEncoder checks if an error message names the encoder as a whole word,
+// so aac isn't blamed for libfdk_aac
+func namesEncoder(msg string, name string) bool {
+	name = strings.ToLower(name)
+	isNamePart := func(r byte) bool {
+		return r == '_' || r == '-' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z'
+	}
+	for start := 0; ; {
+		i := strings.Index(msg[start:], name)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(name)
+		if (i == 0 || !isNamePart(msg[i-1])) && (end == len(msg) || !isNamePart(msg[end])) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+// supportsOption checks if an encoder accepts a private or generic option,
+// encoders whose options weren't detected accept every option
+func supportsOption(name string, encType types.EncoderType, option string) bool {
+	encoder, ok := types.FindEncoder(name, encType)
+	if !ok || len(encoder.Options) == 0 || types.IsGenericOption(option) {
+		return true
+	}
+	return slices.ContainsFunc(encoder.Options, func(o types.AVOption) bool { return o.Name == option })
+}
@@ -0,0 +1,58 @@
+package filesystem
+
+import (
+	"errors"
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestMarkFailedEncoders(t *testing.T) {
+	tests := []struct {
+		name   string
+		video  string
+		audio  string
+		stderr string
+		want   []string // the encoders marked unavailable
+	}{
+		{"unknown audio encoder", "h264_nvenc", "libfdk_aac", "Unknown encoder 'libfdk_aac'", []string{"libfdk_aac"}},
+		{"named hardware encoder", "h264_nvenc", "aac", "[h264_nvenc @ 0x5581] No NVENC capable devices found", []string{"h264_nvenc"}},
+		{"device error without a name", "h264_nvenc", "aac", "Cannot load libcuda.so.1", []string{"h264_nvenc"}},
+		{"device error with software encoders", "libx264", "aac", "Cannot load libcuda.so.1", nil},
+		{"busy device", "h264_nvenc", "aac", "[h264_nvenc @ 0x5581] OpenEncodeSessionEx failed: out of memory (10)", nil},
+		{"encoder outside the candidates", "h264_nvenc", "aac", "Unknown encoder 'mov_text2'", nil},
+		{"other failure", "h264_nvenc", "aac", "moov atom not found", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types.SetEncoders([]types.Encoder{
+				{Type: types.Video, Name: "h264_nvenc"},
+				{Type: types.Video, Name: "libx264"},
+				{Type: types.Audio, Name: "aac"},
+				{Type: types.Audio, Name: "libfdk_aac"},
+			})
+			t.Cleanup(func() { types.SetEncoders(nil) })
+
+			err := &conversionError{err: errors.New("exit status 1"), stderr: tt.stderr}
+			if marked := markFailedEncoders(tt.video, tt.audio, err); marked != (len(tt.want) > 0) {
+				t.Errorf("markFailedEncoders() = %v, want %v", marked, len(tt.want) > 0)
+			}
+			for _, encoder := range types.ListEncoders() {
+				want := false
+				for _, name := range tt.want {
+					want = want || encoder.Name == name
+				}
+				if (encoder.Unavailable != "") != want {
+					t.Errorf("%s unavailable = %q, want marked %v", encoder.Name, encoder.Unavailable, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBusyDeviceIsRetried(t *testing.T) {
+	err := &conversionError{err: errors.New("exit status 1"), stderr: "[h264_nvenc @ 0x5581] OpenEncodeSessionEx failed: out of memory (10)"}
+	if reason := classifyFailure(err); reason != types.DeviceBusy || !reason.Transient() {
+		t.Errorf("got reason %s, want a transient %s", reason, types.DeviceBusy)
+	}
+}
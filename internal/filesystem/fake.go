@@ -0,0 +1,234 @@
+// This file provides a transcoder that doesn't run ffmpeg, so the watch,
+// queue, convert and broadcast pipeline can be exercised without it.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	types "blockbuffer/internal/types"
+)
+
+var errFakeCancelled = errors.New("fake conversion cancelled")
+
+// FakeTranscoder reports the same media for every file and completes each job
+// in a fixed number of progress steps, writing a small text file as the output
+type FakeTranscoder struct {
+	Media     types.MediaInfo   // media info returned for every existing file
+	Steps     int               // progress reports per job
+	StepDelay time.Duration     // delay between progress reports
+	Failures  map[string]string // output names containing the key fail with the value as ffmpeg error output
+	Crop      *types.CropRect   // reported by crop detection, nil for the full frame
+
+	mutex   sync.Mutex
+	running map[string]*fakeRun
+	jobs    []TranscodeJob
+}
+
+type fakeRun struct {
+	outFile string
+	paused  bool
+	resume  chan struct{}
+	cancel  chan struct{}
+}
+
+func NewFakeTranscoder() *FakeTranscoder {
+	return &FakeTranscoder{
+		Media: types.MediaInfo{
+			Format:   "mov,mp4,m4a,3gp,3g2,mj2",
+			Duration: 10,
+			BitRate:  8000000,
+			Size:     10000000,
+			Streams: []types.MediaStream{
+				{Index: 0, Type: types.VideoStream, Codec: "h264", Width: 1920, Height: 1080, FrameRate: 30, PixelFormat: "yuv420p"},
+				{Index: 1, Type: types.AudioStream, Codec: "aac", Channels: 2, ChannelLayout: "stereo", SampleRate: 48000},
+			},
+		},
+		// a 2.40:1 picture letterboxed in the 16:9 frame
+		Crop:      &types.CropRect{Width: 1920, Height: 800, X: 0, Y: 140},
+		Steps:     4,
+		StepDelay: 250 * time.Millisecond,
+		Failures:  map[string]string{},
+		running:   make(map[string]*fakeRun),
+	}
+}
+
+// Probe returns a copy of the configured media info if the file exists
+func (t *FakeTranscoder) Probe(filePath string) (*types.MediaInfo, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, err
+	}
+	media := t.Media
+	media.Streams = append([]types.MediaStream{}, t.Media.Streams...)
+	return &media, nil
+}
+
+// Run reports progress in equal steps and writes the job arguments to the output file
+func (t *FakeTranscoder) Run(job TranscodeJob, progress ProgressFunc) error {
+	run := &fakeRun{outFile: job.OutFile, resume: make(chan struct{}), cancel: make(chan struct{})}
+	t.mutex.Lock()
+	t.running[job.FileID] = run
+	t.jobs = append(t.jobs, job)
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.running, job.FileID)
+		t.mutex.Unlock()
+	}()
+
+	if _, err := os.Stat(job.InFile); err != nil {
+		return &conversionError{err: err, stderr: fmt.Sprintf("%s: No such file or directory", job.InFile)}
+	}
+
+	for step := 1; step < t.Steps; step++ {
+		select {
+		case <-time.After(t.StepDelay):
+		case <-run.cancel:
+			return errFakeCancelled
+		}
+		if err := t.waitWhilePaused(run); err != nil {
+			return err
+		}
+		progress(float32(step) * 100 / float32(t.Steps))
+	}
+
+	for pattern, stderr := range t.Failures {
+		if strings.Contains(job.OutFile, pattern) {
+			return &conversionError{err: errors.New("exit status 1"), stderr: stderr}
+		}
+	}
+	// HLS jobs name variant playlists by pattern and also write a master playlist
+	if master, ok := job.Args["master_pl_name"].(string); ok {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(job.OutFile), master), []byte(describeJob(job)), 0644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(job.OutFile, []byte(describeJob(job)), 0644)
+}
+
+func (t *FakeTranscoder) waitWhilePaused(run *fakeRun) error {
+	for {
+		t.mutex.Lock()
+		paused, resume := run.paused, run.resume
+		t.mutex.Unlock()
+		if !paused {
+			return nil
+		}
+		select {
+		case <-resume:
+		case <-run.cancel:
+			return errFakeCancelled
+		}
+	}
+}
+
+// Cancel aborts the running job of a file and removes its output
+func (t *FakeTranscoder) Cancel(fileId string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if run, ok := t.running[fileId]; ok {
+		close(run.cancel)
+		delete(t.running, fileId)
+		if run.outFile != os.DevNull {
+			os.Remove(run.outFile)
+		}
+	}
+}
+
+// Pause holds the running job of a file before its next progress step
+func (t *FakeTranscoder) Pause(fileId string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	run, ok := t.running[fileId]
+	if !ok {
+		return errNotRunning
+	}
+	run.paused = true
+	return nil
+}
+
+// Resume continues a paused job
+func (t *FakeTranscoder) Resume(fileId string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	run, ok := t.running[fileId]
+	if !ok {
+		return errNotRunning
+	}
+	if run.paused {
+		run.paused = false
+		close(run.resume)
+		run.resume = make(chan struct{})
+	}
+	return nil
+}
+
+// Snapshot writes a blank jpeg so previews can be served without ffmpeg
+func (t *FakeTranscoder) Snapshot(job SnapshotJob) error {
+	if _, err := os.Stat(job.InFile); err != nil {
+		return &conversionError{err: err, stderr: fmt.Sprintf("%s: No such file or directory", job.InFile)}
+	}
+	out, err := os.Create(job.OutFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	img := image.NewGray(image.Rect(0, 0, 320, 180))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: 64}), image.Point{}, draw.Src)
+	return jpeg.Encode(out, img, nil)
+}
+
+// DetectCrop reports the configured crop if the file exists
+func (t *FakeTranscoder) DetectCrop(job CropJob) (types.CropRect, error) {
+	if _, err := os.Stat(job.InFile); err != nil {
+		return types.CropRect{}, &conversionError{err: err, stderr: fmt.Sprintf("%s: No such file or directory", job.InFile)}
+	}
+	if t.Crop != nil {
+		return *t.Crop, nil
+	}
+	video := t.Media.Video()
+	if video == nil {
+		return types.CropRect{}, errors.New("no video stream")
+	}
+	width, height := video.DisplaySize()
+	return types.CropRect{Width: width, Height: height}, nil
+}
+
+// Jobs returns the jobs run so far, in the order they started
+func (t *FakeTranscoder) Jobs() []TranscodeJob {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]TranscodeJob{}, t.jobs...)
+}
+
+// describeJob renders a job with its arguments sorted so outputs are reproducible
+func describeJob(job TranscodeJob) string {
+	keys := make([]string, 0, len(job.Args))
+	for key := range job.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "input: %s\n", job.InFile)
+	if seek, ok := job.InputArgs["ss"]; ok {
+		fmt.Fprintf(&b, "seek: %v\n", seek)
+	}
+	for _, subtitles := range job.Subtitles {
+		fmt.Fprintf(&b, "subtitles: %s\n", subtitles)
+	}
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", key, job.Args[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,283 @@
+// This file runs conversions with the local ffmpeg install and reads their
+// progress from the ffmpeg `-progress` output.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	io "blockbuffer/internal/io"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var errNotRunning = errors.New("no running conversion")
+var errCancelled = errors.New("conversion cancelled")
+
+// FFmpegTranscoder encodes files by running ffmpeg processes
+type FFmpegTranscoder struct {
+	mutex   sync.Mutex
+	running map[string]*ffmpegRun // file ID to running process
+}
+
+// ffmpegRun is a conversion of a file, a cancel or pause that arrives before
+// the process is started is recorded and applied once it starts
+type ffmpegRun struct {
+	outFile   string
+	cmd       *exec.Cmd
+	cancelled bool
+	paused    bool
+}
+
+func NewFFmpegTranscoder() *FFmpegTranscoder {
+	return &FFmpegTranscoder{running: make(map[string]*ffmpegRun)}
+}
+
+// Probe runs ffprobe on a file
+func (t *FFmpegTranscoder) Probe(filePath string) (*types.MediaInfo, error) {
+	return ProbeMedia(filePath)
+}
+
+// Run uses the ffmpeg `-progress` option with a unix-domain socket to report progress,
+// a failed run returns a conversionError carrying the end of the ffmpeg error output
+func (t *FFmpegTranscoder) Run(job TranscodeJob, progress ProgressFunc) error {
+	sockFileName, listener, err := TempSock(job.Duration, progress)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	stderr := &tailBuffer{limit: stderrTailSize}
+	cmd := transcodeOutput(job).
+		GlobalArgs("-progress", "unix://"+sockFileName).
+		OverWriteOutput().
+		WithErrorOutput(stderr).
+		Silent(true).
+		Compile()
+
+	run := &ffmpegRun{outFile: job.OutFile, cmd: cmd}
+	t.mutex.Lock()
+	t.running[job.FileID] = run
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.running, job.FileID)
+		t.mutex.Unlock()
+	}()
+
+	if err := t.start(run); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		io.Logf("Error converting file: %s: %v", io.Error, job.InFile, err)
+		return &conversionError{err: err, stderr: stderr.String()}
+	}
+	return nil
+}
+
+// start starts the process of a run unless it was cancelled while starting,
+// a run paused while starting is stopped right away
+func (t *FFmpegTranscoder) start(run *ffmpegRun) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if run.cancelled {
+		return errCancelled
+	}
+	if err := run.cmd.Start(); err != nil {
+		return err
+	}
+	if run.paused {
+		run.cmd.Process.Signal(syscall.SIGSTOP)
+	}
+	return nil
+}
+
+// transcodeOutput builds the ffmpeg graph of a job, the maps of jobs with
+// subtitle inputs are resolved to streams of each input
+func transcodeOutput(job TranscodeJob) *ffmpeg.Stream {
+	input := ffmpeg.Input(job.InFile, job.InputArgs)
+	if len(job.Subtitles) == 0 {
+		return input.Output(job.OutFile, job.Args)
+	}
+
+	inputs := []*ffmpeg.Stream{input}
+	for _, subtitles := range job.Subtitles {
+		inputs = append(inputs, ffmpeg.Input(subtitles, job.InputArgs))
+	}
+	var streams []*ffmpeg.Stream
+	maps, _ := job.Args["map"].([]string)
+	for _, spec := range maps {
+		index, selector, _ := strings.Cut(spec, ":")
+		if n, err := strconv.Atoi(index); err == nil && n < len(inputs) {
+			streams = append(streams, inputs[n].Get(selector))
+		}
+	}
+	args := ffmpeg.KwArgs{}
+	for key, value := range job.Args {
+		if key != "map" {
+			args[key] = value
+		}
+	}
+	return ffmpeg.Output(streams, job.OutFile, args)
+}
+
+// Cancel interrupts the ffmpeg process of a file and removes the partial output
+func (t *FFmpegTranscoder) Cancel(fileId string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	run, ok := t.running[fileId]
+	if !ok {
+		return
+	}
+	run.cancelled = true
+	if run.cmd.Process == nil {
+		// the process isn't started once it sees the cancel
+		return
+	}
+	if err := run.cmd.Process.Signal(os.Interrupt); err != nil {
+		return
+	}
+	// a paused process only handles the interrupt once continued
+	run.cmd.Process.Signal(syscall.SIGCONT)
+	// analysis passes write to the null device, which must never be removed
+	if run.outFile == os.DevNull {
+		return
+	}
+	if _, err := os.Stat(run.outFile); !os.IsNotExist(err) {
+		io.Logf("Removing incomplete file: %s", io.Info, run.outFile)
+		if err := os.Remove(run.outFile); err != nil {
+			io.Logf("Error deleting file: %v", io.Error, err)
+		}
+	}
+}
+
+// Pause stops the ffmpeg process of a file
+func (t *FFmpegTranscoder) Pause(fileId string) error {
+	return t.setPaused(fileId, true)
+}
+
+// Resume continues a stopped ffmpeg process
+func (t *FFmpegTranscoder) Resume(fileId string) error {
+	return t.setPaused(fileId, false)
+}
+
+// setPaused stops or continues the process of a file, a process that isn't
+// started yet picks up the state when it starts
+func (t *FFmpegTranscoder) setPaused(fileId string, paused bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	run, ok := t.running[fileId]
+	if !ok || run.cancelled {
+		return errNotRunning
+	}
+	run.paused = paused
+	if run.cmd.Process == nil {
+		return nil
+	}
+	if paused {
+		return run.cmd.Process.Signal(syscall.SIGSTOP)
+	}
+	return run.cmd.Process.Signal(syscall.SIGCONT)
+}
+
+// Snapshot writes the first frame of the filtered source as an image
+func (t *FFmpegTranscoder) Snapshot(job SnapshotJob) error {
+	stderr := &tailBuffer{limit: stderrTailSize}
+	err := ffmpeg.Input(job.InFile, job.InputArgs).
+		Output(job.OutFile, ffmpeg.KwArgs{"vf": job.Filter, "frames:v": 1, "q:v": 3}).
+		OverWriteOutput().
+		WithErrorOutput(stderr).
+		Silent(true).
+		Run()
+	if err != nil {
+		return &conversionError{err: err, stderr: stderr.String()}
+	}
+	return nil
+}
+
+var cropdetectResult = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// DetectCrop runs the cropdetect filter over a section, its bounds grow over
+// the frames analysed so the last reported crop holds the picture of every frame
+func (t *FFmpegTranscoder) DetectCrop(job CropJob) (types.CropRect, error) {
+	stderr := &tailBuffer{limit: stderrTailSize}
+	err := ffmpeg.Input(job.InFile, job.InputArgs).
+		Output(os.DevNull, ffmpeg.KwArgs{
+			"vf": "cropdetect=round=2:reset=0",
+			"t":  types.Timecode(job.Duration).String(),
+			"an": "",
+			"sn": "",
+			"f":  "null",
+		}).
+		WithErrorOutput(stderr).
+		Silent(true).
+		Run()
+	if err != nil {
+		return types.CropRect{}, &conversionError{err: err, stderr: stderr.String()}
+	}
+
+	matches := cropdetectResult.FindAllStringSubmatch(stderr.String(), -1)
+	if len(matches) == 0 {
+		return types.CropRect{}, fmt.Errorf("no crop reported for %s", job.InFile)
+	}
+	values := make([]int, 4)
+	for i, value := range matches[len(matches)-1][1:] {
+		values[i], _ = strconv.Atoi(value)
+	}
+	return types.CropRect{Width: values[0], Height: values[1], X: values[2], Y: values[3]}, nil
+}
+
+// TempSock listens on a unix socket for ffmpeg progress reports, the listener
+// must be closed once ffmpeg exits
+func TempSock(totalDuration float64, progress ProgressFunc) (string, net.Listener, error) {
+	sockFileName := path.Join(os.TempDir(), fmt.Sprintf("%d_sock", rand.Int()))
+	l, err := net.Listen("unix", sockFileName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	go func() {
+		re := regexp.MustCompile(`out_time_ms=(\d+)`)
+		fd, err := l.Accept()
+		if err != nil {
+			// listener closed before ffmpeg connected, e.g. ffmpeg failed to start
+			return
+		}
+		defer fd.Close()
+		buf := make([]byte, 16)
+		data := ""
+		for {
+			n, err := fd.Read(buf)
+			if err != nil {
+				return
+			}
+			data += string(buf[:n])
+			a := re.FindAllStringSubmatch(data, -1)
+			cp := 0.00
+			if len(a) > 0 && len(a[len(a)-1]) > 0 {
+				c, _ := strconv.Atoi(a[len(a)-1][len(a[len(a)-1])-1])
+				cp = float64(c) / totalDuration / 1000000
+			}
+			// completion is reported from the ffmpeg exit status
+			if strings.Contains(data, "progress=end") {
+				break
+			}
+			if cp > 0.00 && cp < 1.00 {
+				progress(float32(cp * 100))
+			}
+		}
+	}()
+
+	return sockFileName, l, nil
+}
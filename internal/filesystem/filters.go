@@ -0,0 +1,130 @@
+// This file compiles the filter lists of presets into ffmpeg filter chains
+// and tracks how the filters change the size of the source.
+package filesystem
+
+import (
+	"fmt"
+	"strings"
+
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// filterArgs sets the video and audio filter chains of a preset, the scale
+// rule follows the preset filters and is sized for the filtered source,
+// packaged presets move the video chain into their filter graph
+func filterArgs(preset types.PresetBundle, media *types.MediaInfo, args ffmpeg.KwArgs) {
+	if !preset.AudioOnly() {
+		filters := preset.VideoPreset.Filters
+		chain := []string{filterChain(filters)}
+		if preset.Packaging == nil {
+			chain = append(chain, scaleFilter(filteredMedia(media, filters), preset.VideoPreset.Scale))
+		}
+		if vf := joinFilters(chain...); vf != "" {
+			args["vf"] = vf
+		}
+	}
+	if af := filterChain(preset.AudioPreset.Filters); af != "" {
+		args["af"] = af
+	}
+}
+
+// filterChain compiles filters into a comma separated chain, empty without filters
+func filterChain(filters []types.Filter) string {
+	compiled := make([]string, len(filters))
+	for i, f := range filters {
+		compiled[i] = compileFilter(f)
+	}
+	return joinFilters(compiled...)
+}
+
+func compileFilter(f types.Filter) string {
+	name := f.FilterName()
+	switch f.Type {
+	case types.FilterDeinterlace:
+		return name + "=deint=interlaced"
+	case types.FilterCrop:
+		if f.X == nil && f.Y == nil {
+			return fmt.Sprintf("crop=%d:%d", f.Width, f.Height)
+		}
+		x, y := "(iw-ow)/2", "(ih-oh)/2"
+		if f.X != nil {
+			x = fmt.Sprint(*f.X)
+		}
+		if f.Y != nil {
+			y = fmt.Sprint(*f.Y)
+		}
+		return fmt.Sprintf("crop=%d:%d:%s:%s", f.Width, f.Height, x, y)
+	case types.FilterDenoise:
+		if f.Strength == 0 {
+			return name
+		}
+		if name == "nlmeans" {
+			return fmt.Sprintf("nlmeans=s=%g", f.Strength)
+		}
+		return fmt.Sprintf("hqdn3d=luma_spatial=%g", f.Strength)
+	case types.FilterLUT:
+		return "lut3d=file=" + escapeFilterValue(f.File)
+	case types.FilterFPS:
+		return "fps=" + f.Rate
+	case types.FilterRotate:
+		switch f.Angle {
+		case 90:
+			return "transpose=clock"
+		case 270:
+			return "transpose=cclock"
+		default:
+			return "transpose=clock,transpose=clock"
+		}
+	case types.FilterResample:
+		return "aresample=" + f.Rate
+	case types.FilterVolume:
+		return "volume=" + f.Gain
+	}
+	return name
+}
+
+// joinFilters chains filters, skipping empty ones
+func joinFilters(filters ...string) string {
+	var chain []string
+	for _, f := range filters {
+		if f != "" {
+			chain = append(chain, f)
+		}
+	}
+	return strings.Join(chain, ",")
+}
+
+// filteredMedia returns the media as seen after the video filters, so the
+// scale rule and rendition ladder are sized for the cropped or rotated video
+func filteredMedia(media *types.MediaInfo, filters []types.Filter) *types.MediaInfo {
+	video := media.Video()
+	if video == nil || len(filters) == 0 {
+		return media
+	}
+
+	// filters see frames in display orientation
+	stream := *video
+	stream.Width, stream.Height = video.DisplaySize()
+	stream.Rotation = 0
+	for _, f := range filters {
+		switch f.Type {
+		case types.FilterCrop:
+			stream.Width, stream.Height = min(f.Width, stream.Width), min(f.Height, stream.Height)
+		case types.FilterRotate:
+			if f.Angle != 180 {
+				stream.Width, stream.Height = stream.Height, stream.Width
+			}
+		}
+	}
+
+	filtered := *media
+	filtered.Streams = append([]types.MediaStream{}, media.Streams...)
+	for i := range filtered.Streams {
+		if filtered.Streams[i].Index == video.Index {
+			filtered.Streams[i] = stream
+		}
+	}
+	return &filtered
+}
@@ -0,0 +1,88 @@
+package filesystem
+
+import (
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestCompileFilter(t *testing.T) {
+	x, y := 0, 140
+	tests := []struct {
+		name   string
+		filter types.Filter
+		want   string
+	}{
+		{"deinterlace", types.Filter{Type: types.FilterDeinterlace}, "yadif=deint=interlaced"},
+		{"deinterlace method", types.Filter{Type: types.FilterDeinterlace, Method: "bwdif"}, "bwdif=deint=interlaced"},
+		{"centred crop", types.Filter{Type: types.FilterCrop, Width: 1920, Height: 800}, "crop=1920:800"},
+		{"crop offsets", types.Filter{Type: types.FilterCrop, Width: 1920, Height: 800, X: &x, Y: &y}, "crop=1920:800:0:140"},
+		{"crop y offset", types.Filter{Type: types.FilterCrop, Width: 1920, Height: 800, Y: &y}, "crop=1920:800:(iw-ow)/2:140"},
+		{"denoise", types.Filter{Type: types.FilterDenoise}, "hqdn3d"},
+		{"denoise strength", types.Filter{Type: types.FilterDenoise, Strength: 4}, "hqdn3d=luma_spatial=4"},
+		{"nlmeans strength", types.Filter{Type: types.FilterDenoise, Method: "nlmeans", Strength: 1.5}, "nlmeans=s=1.5"},
+		{"lut", types.Filter{Type: types.FilterLUT, File: "/luts/log c.cube"}, "lut3d=file=/luts/log c.cube"},
+		{"lut path escaping", types.Filter{Type: types.FilterLUT, File: `C:\luts\a.cube`}, `lut3d=file=C\\:\\\\luts\\\\a.cube`},
+		{"fps", types.Filter{Type: types.FilterFPS, Rate: "30000/1001"}, "fps=30000/1001"},
+		{"rotate 90", types.Filter{Type: types.FilterRotate, Angle: 90}, "transpose=clock"},
+		{"rotate 180", types.Filter{Type: types.FilterRotate, Angle: 180}, "transpose=clock,transpose=clock"},
+		{"rotate 270", types.Filter{Type: types.FilterRotate, Angle: 270}, "transpose=cclock"},
+		{"resample", types.Filter{Type: types.FilterResample, Rate: "48000"}, "aresample=48000"},
+		{"volume", types.Filter{Type: types.FilterVolume, Gain: "-3dB"}, "volume=-3dB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compileFilter(tt.filter); got != tt.want {
+				t.Errorf("compileFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterChain(t *testing.T) {
+	filters := []types.Filter{
+		{Type: types.FilterDeinterlace},
+		{Type: types.FilterCrop, Width: 1920, Height: 800},
+	}
+	if got, want := filterChain(filters), "yadif=deint=interlaced,crop=1920:800"; got != want {
+		t.Errorf("filterChain() = %q, want %q", got, want)
+	}
+	if got := filterChain(nil); got != "" {
+		t.Errorf("filterChain(nil) = %q, want empty", got)
+	}
+	if got, want := joinFilters("", "fps=25", ""), "fps=25"; got != want {
+		t.Errorf("joinFilters() = %q, want %q", got, want)
+	}
+}
+
+func TestFilteredMedia(t *testing.T) {
+	tests := []struct {
+		name    string
+		media   *types.MediaInfo
+		filters []types.Filter
+		width   int
+		height  int
+	}{
+		{"no filters", videoMedia(1920, 1080, 0), nil, 1920, 1080},
+		{"crop", videoMedia(1920, 1080, 0), []types.Filter{{Type: types.FilterCrop, Width: 1920, Height: 800}}, 1920, 800},
+		{"crop larger than the frame", videoMedia(1280, 720, 0), []types.Filter{{Type: types.FilterCrop, Width: 1920, Height: 800}}, 1280, 720},
+		{"rotate", videoMedia(1920, 1080, 0), []types.Filter{{Type: types.FilterRotate, Angle: 90}}, 1080, 1920},
+		{"rotate 180", videoMedia(1920, 1080, 0), []types.Filter{{Type: types.FilterRotate, Angle: 180}}, 1920, 1080},
+		{"crop then rotate", videoMedia(1920, 1080, 0), []types.Filter{{Type: types.FilterCrop, Width: 1440, Height: 1080}, {Type: types.FilterRotate, Angle: 270}}, 1080, 1440},
+		{"rotated source in display orientation", videoMedia(1920, 1080, 90), []types.Filter{{Type: types.FilterCrop, Width: 1080, Height: 1080}}, 1080, 1080},
+		{"other filters keep the size", videoMedia(1920, 1080, 0), []types.Filter{{Type: types.FilterFPS, Rate: "25"}}, 1920, 1080},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.media.Video()
+			got := filteredMedia(tt.media, tt.filters)
+			width, height := got.Video().DisplaySize()
+			if width != tt.width || height != tt.height {
+				t.Errorf("filtered size = %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+			if *tt.media.Video() != before {
+				t.Error("filteredMedia modified the source media")
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// This file packages sources into HLS or DASH with a rendition ladder, so
+// outputs can be streamed in the browser.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	io "blockbuffer/internal/io"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// errInvalidPackaging is returned when a packaged preset can't be applied to a source
+var errInvalidPackaging = errors.New("invalid packaging")
+
+// rendition is a ladder rung sized for the source
+type rendition struct {
+	width, height int
+	bitrate       int64
+}
+
+// ladderFor sizes the rungs of a ladder for the source, rungs larger than the
+// source are left out and a source smaller than every rung gets the lowest rung
+// at its own size
+func ladderFor(media *types.MediaInfo, packaging *types.Packaging) ([]rendition, error) {
+	video := media.Video()
+	if video == nil {
+		return nil, fmt.Errorf("%w: the source has no video stream", errInvalidPackaging)
+	}
+	srcW, srcH := video.DisplaySize()
+	if srcW <= 0 || srcH <= 0 {
+		return nil, fmt.Errorf("%w: the source size is unknown", errInvalidPackaging)
+	}
+	short := min(srcW, srcH)
+
+	var ladder []rendition
+	var lowest *types.Rendition
+	for _, rung := range packaging.Rungs() {
+		bitrate, err := types.ParseBitrate(rung.Bitrate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPackaging, err)
+		}
+		if lowest == nil || rung.Height < lowest.Height {
+			lowest = &rung
+		}
+		if rung.Height > short {
+			continue
+		}
+		ladder = append(ladder, sizeRendition(srcW, srcH, rung.Height, bitrate))
+	}
+	if len(ladder) == 0 && lowest != nil {
+		bitrate, _ := types.ParseBitrate(lowest.Bitrate)
+		ladder = append(ladder, sizeRendition(srcW, srcH, short, bitrate))
+	}
+	return ladder, nil
+}
+
+// sizeRendition scales the short side of the source to the rung height
+func sizeRendition(srcW int, srcH int, short int, bitrate int64) rendition {
+	factor := float64(short) / float64(min(srcW, srcH))
+	return rendition{
+		width:   roundTo(float64(srcW)*factor, defaultRounding),
+		height:  roundTo(float64(srcH)*factor, defaultRounding),
+		bitrate: bitrate,
+	}
+}
+
+// packageArgs adds the ladder and muxer options of a packaged preset to the
+// preset arguments and returns the file ffmpeg writes to, the preset video
+// filters run before the ladder is split
+func packageArgs(preset types.PresetBundle, media *types.MediaInfo, args ffmpeg.KwArgs, output types.Output) (string, error) {
+	packaging := preset.Packaging
+	ladder, err := ladderFor(filteredMedia(media, preset.VideoPreset.Filters), packaging)
+	if err != nil {
+		return "", err
+	}
+	segment := packaging.Segment()
+	video, audio := packageStreams(media, args)
+	hasAudio := len(audio) > 0
+	// data streams can't be carried in the segments
+	delete(args, "c:d")
+
+	// one scaled copy of the video per rendition
+	labels := make([]string, len(ladder))
+	filters := make([]string, len(ladder))
+	maps := []string{}
+	for i, r := range ladder {
+		labels[i] = fmt.Sprintf("[s%d]", i)
+		filters[i] = fmt.Sprintf("[s%d]scale=%d:%d,setsar=1[v%d]", i, r.width, r.height, i)
+		maps = append(maps, fmt.Sprintf("[v%d]", i))
+		args[fmt.Sprintf("b:v:%d", i)] = fmt.Sprint(r.bitrate)
+		args[fmt.Sprintf("maxrate:v:%d", i)] = fmt.Sprint(r.bitrate)
+		args[fmt.Sprintf("bufsize:v:%d", i)] = fmt.Sprint(r.bitrate * 2)
+	}
+	source := "[" + video + "]"
+	if vf, ok := args["vf"].(string); ok {
+		source += vf + ","
+		delete(args, "vf")
+	}
+	split := fmt.Sprintf("%ssplit=%d%s", source, len(ladder), strings.Join(labels, ""))
+	args["filter_complex"] = split + ";" + strings.Join(filters, ";")
+	// segments of every rendition start on the same keyframes so players can switch between them
+	args["force_key_frames"] = fmt.Sprintf("expr:gte(t,n_forced*%d)", segment)
+	if hasAudio {
+		if _, ok := args["b:a"]; !ok {
+			args["b:a"] = "128k"
+		}
+	} else {
+		delete(args, "c:a")
+		delete(args, "ar")
+		delete(args, "b:a")
+	}
+
+	dir := output.OutputDir
+	switch packaging.Format {
+	case types.PackageDASH:
+		// renditions share the audio tracks
+		maps = append(maps, audio...)
+		sets := "id=0,streams=v"
+		if hasAudio {
+			sets += " id=1,streams=a"
+		}
+		args["map"] = maps
+		args["f"] = "dash"
+		args["seg_duration"] = fmt.Sprint(segment)
+		args["adaptation_sets"] = sets
+		args["use_template"] = "1"
+		args["use_timeline"] = "1"
+		args["hls_playlist"] = "1"
+		args["init_seg_name"] = "init_$RepresentationID$.m4s"
+		args["media_seg_name"] = "chunk_$RepresentationID$_$Number%05d$.m4s"
+		return output.FilePath, nil
+	default:
+		streams := make([]string, len(ladder))
+		for i := range ladder {
+			streams[i] = fmt.Sprintf("v:%d", i)
+		}
+		if len(audio) == 1 {
+			// each HLS variant carries its own copy of the audio
+			for i := range ladder {
+				maps = append(maps, audio[0])
+				streams[i] += fmt.Sprintf(",a:%d", i)
+			}
+		} else if len(audio) > 1 {
+			// several audio tracks are alternative renditions shared by the variants
+			for i := range ladder {
+				streams[i] += ",agroup:audio"
+			}
+			for i, spec := range audio {
+				maps = append(maps, spec)
+				stream := fmt.Sprintf("a:%d,agroup:audio", i)
+				if language := audioLanguage(media, spec); language != "" {
+					stream += ",language:" + language
+				}
+				if i == 0 {
+					stream += ",default:yes"
+				}
+				streams = append(streams, stream)
+			}
+		}
+		args["map"] = maps
+		args["f"] = "hls"
+		args["hls_time"] = fmt.Sprint(segment)
+		args["hls_playlist_type"] = "vod"
+		args["hls_segment_filename"] = filepath.Join(dir, "stream_%v_%05d.ts")
+		args["master_pl_name"] = filepath.Base(output.FilePath)
+		args["var_stream_map"] = strings.Join(streams, " ")
+		return filepath.Join(dir, "stream_%v.m3u8"), nil
+	}
+}
+
+// packageStreams returns the video stream the ladder is scaled from and the
+// audio streams packaged with it, following the stream map of the preset when
+// it has one; subtitle and data streams are never packaged
+func packageStreams(media *types.MediaInfo, args ffmpeg.KwArgs) (string, []string) {
+	maps, ok := args["map"].([]string)
+	if !ok {
+		if media.Audio() == nil {
+			return "0:v", nil
+		}
+		return "0:v", []string{"0:a:0"}
+	}
+
+	video := ""
+	var audio []string
+	for _, spec := range maps {
+		switch {
+		case strings.HasPrefix(spec, "0:v:") && video == "":
+			video = spec
+		case strings.HasPrefix(spec, "0:a:"):
+			audio = append(audio, spec)
+		}
+	}
+	if video == "" {
+		video = "0:v"
+	}
+	return video, audio
+}
+
+// audioLanguage returns the language of the audio stream of a specifier such as 0:a:1
+func audioLanguage(media *types.MediaInfo, spec string) string {
+	position, err := strconv.Atoi(strings.TrimPrefix(spec, "0:a:"))
+	streams := streamsOfType(media, types.AudioStream)
+	if err != nil || position < 0 || position >= len(streams) {
+		return ""
+	}
+	return streams[position].Language
+}
+
+// runPackage encodes the ladder of a packaged output in a single pass
+func runPackage(inputFile types.File, i int, output types.Output, profile types.PresetBundle, ffmpegArgs ffmpeg.KwArgs) error {
+	inputArgs := trimArgs(inputFile, ffmpegArgs)
+	outFile, err := packageArgs(profile, inputFile.Media, ffmpegArgs, output)
+	if err != nil {
+		return err
+	}
+	io.Logf("Packaging %s with preset %s, ffmpeg args: %v", io.Info, inputFile.FilePath, profile.Name, ffmpegArgs)
+	return convertWithProgress(TranscodeJob{
+		FileID:    inputFile.ID,
+		Output:    i,
+		InFile:    inputFile.FilePath,
+		OutFile:   outFile,
+		InputArgs: inputArgs,
+		Args:      ffmpegArgs,
+		Duration:  inputFile.Duration,
+	}, 0, 1)
+}
+
+// removeOutput deletes a written or partial output, packaged outputs are
+// removed with their directory of segments
+func removeOutput(output types.Output) {
+	removeFiles(output.Subtitles)
+	if output.Package == "" {
+		os.Remove(output.FilePath)
+		return
+	}
+	if err := os.RemoveAll(output.OutputDir); err != nil {
+		io.Logf("Error deleting %s: %v", io.Error, output.OutputDir, err)
+	}
+}
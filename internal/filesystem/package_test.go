@@ -0,0 +1,120 @@
+package filesystem
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestLadderFor(t *testing.T) {
+	defaultLadder := &types.Packaging{Format: types.PackageHLS}
+	tests := []struct {
+		name      string
+		media     *types.MediaInfo
+		packaging *types.Packaging
+		want      []rendition
+		wantErr   bool
+	}{
+		{"1080p source", videoMedia(1920, 1080, 0), defaultLadder, []rendition{
+			{1920, 1080, 5000000}, {1280, 720, 2800000}, {854, 480, 1400000}, {640, 360, 800000},
+		}, false},
+		{"larger rungs are left out", videoMedia(1280, 720, 0), defaultLadder, []rendition{
+			{1280, 720, 2800000}, {854, 480, 1400000}, {640, 360, 800000},
+		}, false},
+		{"portrait source", videoMedia(1080, 1920, 0), defaultLadder, []rendition{
+			{1080, 1920, 5000000}, {720, 1280, 2800000}, {480, 854, 1400000}, {360, 640, 800000},
+		}, false},
+		{"rotated source", videoMedia(1280, 720, 90), defaultLadder, []rendition{
+			{720, 1280, 2800000}, {480, 854, 1400000}, {360, 640, 800000},
+		}, false},
+		{"source below every rung", videoMedia(320, 240, 0), defaultLadder, []rendition{
+			{320, 240, 800000},
+		}, false},
+		{"preset ladder", videoMedia(1920, 1080, 0), &types.Packaging{Ladder: []types.Rendition{{Height: 540, Bitrate: "2M"}}}, []rendition{
+			{960, 540, 2000000},
+		}, false},
+		{"invalid bitrate", videoMedia(1920, 1080, 0), &types.Packaging{Ladder: []types.Rendition{{Height: 540, Bitrate: "fast"}}}, nil, true},
+		{"no video", &types.MediaInfo{}, defaultLadder, nil, true},
+		{"unknown size", videoMedia(0, 0, 0), defaultLadder, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ladderFor(tt.media, tt.packaging)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidPackaging) {
+					t.Errorf("got error %v, want %v", err, errInvalidPackaging)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ladderFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageArgsFollowStreamMap(t *testing.T) {
+	media := videoMedia(1280, 720, 0)
+	media.Streams = append(media.Streams,
+		types.MediaStream{Index: 1, Type: types.AudioStream, Codec: "aac", Language: "eng"},
+		types.MediaStream{Index: 2, Type: types.AudioStream, Codec: "aac", Language: "fra"},
+		types.MediaStream{Index: 3, Type: types.SubtitleStream, Codec: "subrip", Language: "eng"},
+		types.MediaStream{Index: 4, Type: types.DataStream, Codec: "bin_data"},
+	)
+	tests := []struct {
+		name    string
+		format  types.PackageFormat
+		streams *types.StreamMap
+		maps    []string
+		varMap  string // HLS only
+	}{
+		{"hls without a stream map", types.PackageHLS, nil,
+			[]string{"[v0]", "[v1]", "[v2]", "0:a:0", "0:a:0", "0:a:0"}, "v:0,a:0 v:1,a:1 v:2,a:2"},
+		{"hls with a selected track", types.PackageHLS, &types.StreamMap{Audio: &types.StreamSelection{Mode: types.SelectTracks, Tracks: []int{2}}, Data: true},
+			[]string{"[v0]", "[v1]", "[v2]", "0:a:1", "0:a:1", "0:a:1"}, "v:0,a:0 v:1,a:1 v:2,a:2"},
+		{"hls without audio", types.PackageHLS, &types.StreamMap{Audio: &types.StreamSelection{Mode: types.SelectNone}},
+			[]string{"[v0]", "[v1]", "[v2]"}, "v:0 v:1 v:2"},
+		{"hls with several tracks", types.PackageHLS, &types.StreamMap{Audio: &types.StreamSelection{Mode: types.SelectAll}},
+			[]string{"[v0]", "[v1]", "[v2]", "0:a:0", "0:a:1"},
+			"v:0,agroup:audio v:1,agroup:audio v:2,agroup:audio a:0,agroup:audio,language:eng,default:yes a:1,agroup:audio,language:fra"},
+		{"dash with a selected language", types.PackageDASH, &types.StreamMap{Audio: &types.StreamSelection{Mode: types.SelectLanguages, Languages: []string{"fra"}}},
+			[]string{"[v0]", "[v1]", "[v2]", "0:a:1"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset := types.PresetBundle{
+				Name:        "Streaming",
+				VideoPreset: types.VideoPreset{Codec: types.CodecList{"libx264"}},
+				AudioPreset: types.AudioPreset{Codec: types.CodecList{"aac"}},
+				Packaging:   &types.Packaging{Format: tt.format},
+				Streams:     tt.streams,
+			}
+			args := presetArgs(preset, "libx264", "aac")
+			if err := streamArgs(preset, media, nil, args); err != nil {
+				t.Fatal(err)
+			}
+			output := types.Output{OutputDir: t.TempDir(), FilePath: "master.m3u8"}
+			if _, err := packageArgs(preset, media, args, output); err != nil {
+				t.Fatal(err)
+			}
+
+			if maps, _ := args["map"].([]string); !slices.Equal(maps, tt.maps) {
+				t.Errorf("map = %v, want %v", maps, tt.maps)
+			}
+			if varMap, _ := args["var_stream_map"].(string); varMap != tt.varMap {
+				t.Errorf("var_stream_map = %q, want %q", varMap, tt.varMap)
+			}
+			if _, ok := args["c:d"]; ok {
+				t.Error("data streams are copied into a package")
+			}
+			if _, ok := args["b:a"]; ok != (len(tt.maps) > 3) {
+				t.Errorf("audio bitrate set = %v, want %v", ok, len(tt.maps) > 3)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// This file resolves which preset a file is converted with and
+// translates the preset into ffmpeg arguments and output names.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	io "blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// errMissingStream is returned when a source lacks a stream the preset needs
+var errMissingStream = errors.New("missing stream")
+
+// errNoOutputs is returned when none of the output rules of a file resolve to an output
+var errNoOutputs = errors.New("no outputs")
+
+// resolvePreset returns the preset bound to the file, falling back to the
+// global binding and then to the default preset
+func resolvePreset(fileId string) types.PresetBundle {
+	if name, ok := store.PresetBinding(fileId); ok {
+		if preset, ok := types.GetPreset(name); ok {
+			return preset
+		}
+		io.Logf("Preset %s bound to %s not found, using fallback", io.Warn, name, fileId)
+	}
+
+	if global := store.GetGlobalBinding(); global != "" {
+		if preset, ok := types.GetPreset(global); ok {
+			return preset
+		}
+		io.Logf("Global preset %s not found, using default", io.Warn, global)
+	}
+
+	return types.DefaultPreset
+}
+
+// outputFileName builds the output name from the input name, preset name and
+// preset extension, e.g. clip.mp4 + DNxHR -> clip_dnxhr.mov
+func outputFileName(inputPath string, preset types.PresetBundle) string {
+	base := outputBaseName(inputPath, preset)
+	ext := strings.TrimPrefix(preset.Extension, ".")
+	if ext == "" {
+		ext = types.DefaultPreset.Extension
+	}
+	return base + "." + ext
+}
+
+// outputBaseName builds the output name without its extension
+func outputBaseName(inputPath string, preset types.PresetBundle) string {
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	suffix := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(preset.Name), "_"), "_")
+	if suffix != "" {
+		base += "_" + suffix
+	}
+	return base
+}
+
+// checkStreams makes sure the source has the streams a preset writes, sources
+// that couldn't be probed are left to ffmpeg
+func checkStreams(preset types.PresetBundle, media *types.MediaInfo) error {
+	if media == nil {
+		return nil
+	}
+	if preset.AudioOnly() && media.Audio() == nil {
+		return fmt.Errorf("%w: preset %s is audio-only and the source has no audio", errMissingStream, preset.Name)
+	}
+	return nil
+}
+
+// presetArgs converts a preset into ffmpeg output arguments for the resolved
+// encoders, options the chosen encoder doesn't accept are left out so that
+// presets can share options between their encoder candidates
+func presetArgs(preset types.PresetBundle, videoCodec string, audioCodec string) ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{}
+	if preset.AudioOnly() {
+		args["vn"] = ""
+	}
+	if videoCodec != "" {
+		args["c:v"] = videoCodec
+	}
+	if preset.VideoPreset.Format != "" {
+		args["pix_fmt"] = preset.VideoPreset.Format
+	}
+	if audioCodec != "" {
+		args["c:a"] = audioCodec
+	}
+	if preset.AudioPreset.SampleRate != nil && *preset.AudioPreset.SampleRate != "" {
+		args["ar"] = *preset.AudioPreset.SampleRate
+	}
+	if preset.AudioPreset.Format != "" {
+		args["sample_fmt"] = preset.AudioPreset.Format
+	}
+	if preset.AudioPreset.Channels > 0 {
+		args["ac"] = preset.AudioPreset.Channels
+	}
+	if preset.AudioPreset.Bitrate != "" && audioCodec != types.CopyCodec {
+		args["b:a"] = preset.AudioPreset.Bitrate
+	}
+
+	// encoder options are scoped to their stream type so that video and audio
+	// options sharing a name (e.g. profile) don't overwrite each other
+	if preset.VideoPreset.Options != nil {
+		for _, opt := range *preset.VideoPreset.Options {
+			if !supportsOption(videoCodec, types.Video, opt.Name) {
+				io.Logf("Skipping option %s, not supported by %s", io.Debug, opt.Name, videoCodec)
+				continue
+			}
+			args[opt.Name+":v"] = opt.Value
+		}
+	}
+	if preset.AudioPreset.Options != nil {
+		for _, opt := range *preset.AudioPreset.Options {
+			if !supportsOption(audioCodec, types.Audio, opt.Name) {
+				io.Logf("Skipping option %s, not supported by %s", io.Debug, opt.Name, audioCodec)
+				continue
+			}
+			args[opt.Name+":a"] = opt.Value
+		}
+	}
+	return args
+}
+
+// hotFolderOf returns the hot folder a file was found in
+func hotFolderOf(file types.File) types.HotFolder {
+	return types.GetHotFolder(file.HotFolder)
+}
+
+// planOutputs resolves the output rules into the list of outputs for a file,
+// presets of the file's hot folder replace the global output rules; rules
+// writing to the same path produce a single output
+func planOutputs(file types.File) ([]types.Output, error) {
+	folder := hotFolderOf(file)
+	rules := types.GetOutputRules()
+	if len(folder.Presets) > 0 {
+		rules = []types.OutputRule{}
+		for _, name := range folder.Presets {
+			rules = append(rules, types.OutputRule{Preset: name})
+		}
+	}
+	if len(rules) == 0 {
+		rules = []types.OutputRule{{}}
+	}
+
+	outputs := []types.Output{}
+	var missing []string
+	for _, rule := range rules {
+		preset := resolvePreset(file.ID)
+		if rule.Preset != "" {
+			var ok bool
+			if preset, ok = types.GetPreset(rule.Preset); !ok {
+				io.Logf("Preset %s in output rule not found, skipping output", io.Warn, rule.Preset)
+				missing = append(missing, rule.Preset)
+				continue
+			}
+		}
+
+		dir := rule.OutputDir
+		if dir == "" {
+			dir = folder.OutputDir
+		}
+		dir = mirrorDir(dir, file)
+		output := types.Output{
+			Preset:    preset.Name,
+			OutputDir: dir,
+			FilePath:  filepath.Join(dir, outputFileName(file.FilePath, preset)),
+			Status:    types.Queued,
+		}
+		// packaged outputs get a directory per job named like a single file output
+		if preset.Packaging != nil {
+			output.OutputDir = filepath.Join(dir, outputBaseName(file.FilePath, preset))
+			output.FilePath = filepath.Join(output.OutputDir, preset.Packaging.Playlist())
+			output.Package = preset.Packaging.Format
+		}
+		if slices.ContainsFunc(outputs, func(planned types.Output) bool { return planned.FilePath == output.FilePath }) {
+			io.Logf("Output %s is planned by more than one output rule, skipping duplicate", io.Warn, output.FilePath)
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		return outputs, fmt.Errorf("%w: presets not found: %s", errNoOutputs, strings.Join(missing, ", "))
+	}
+	return outputs, nil
+}
+
+// mirrorDir appends the path of the source relative to its watch directory to
+// an output directory when mirroring the source tree
+func mirrorDir(outputDir string, file types.File) string {
+	if !*opts.MirrorOutput || file.WatchDir == "" {
+		return outputDir
+	}
+	rel, err := filepath.Rel(file.WatchDir, filepath.Dir(file.FilePath))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return outputDir
+	}
+	return filepath.Join(outputDir, rel)
+}
@@ -0,0 +1,89 @@
+// This file extracts a poster frame and a contact sheet from each source so
+// clips can be identified without opening them.
+package filesystem
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+
+	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+const previewWidth = 320      // width of the thumbnail and of each contact sheet frame
+const contactSheetColumns = 4 // frames per row of the contact sheet
+const posterPosition = 0.1    // poster frame position as a fraction of the source duration
+
+// previewSlots limits how many sources are decoded for previews at once, so a
+// scan of a full watch folder doesn't compete with the conversions
+var previewSlots = make(chan struct{}, 2)
+
+// generatePreviews extracts the previews of a file in the background and
+// broadcasts the file once they are written
+func generatePreviews(file types.File) {
+	if file.Media == nil || file.Media.Video() == nil {
+		return
+	}
+	go func() {
+		previewSlots <- struct{}{}
+		defer func() { <-previewSlots }()
+
+		if err := os.MkdirAll(filepath.Dir(store.ThumbnailPath(file.ID)), 0755); err != nil {
+			io.Logf("Error creating preview directory: %v", io.Error, err)
+			return
+		}
+		previews := types.Previews{
+			Thumbnail:    extractThumbnail(file),
+			ContactSheet: extractContactSheet(file),
+		}
+		updated, ok := store.ModifyFile(file.ID, func(file *types.File) {
+			file.Previews = previews
+		})
+		if ok {
+			broadcastFile(updated, true)
+		}
+	}()
+}
+
+func extractThumbnail(file types.File) bool {
+	err := Backend.Snapshot(SnapshotJob{
+		InFile:    file.FilePath,
+		OutFile:   store.ThumbnailPath(file.ID),
+		InputArgs: ffmpeg.KwArgs{"ss": types.Timecode(file.Media.Duration * posterPosition).String()},
+		Filter:    fmt.Sprintf("scale=%d:-2", previewWidth),
+	})
+	if err != nil {
+		io.Logf("Error extracting thumbnail of %s: %v", io.Warn, file.FilePath, err)
+		return false
+	}
+	return true
+}
+
+// extractContactSheet tiles frames taken at even intervals, only keyframes
+// are decoded so long sources don't take as long as a conversion
+func extractContactSheet(file types.File) bool {
+	frames := *opts.ContactSheet
+	if frames <= 0 || file.Media.Duration <= 0 {
+		return false
+	}
+	columns := min(frames, contactSheetColumns)
+	rows := int(math.Ceil(float64(frames) / float64(columns)))
+	err := Backend.Snapshot(SnapshotJob{
+		InFile:    file.FilePath,
+		OutFile:   store.ContactSheetPath(file.ID),
+		InputArgs: ffmpeg.KwArgs{"skip_frame": "nokey"},
+		Filter: fmt.Sprintf("fps=%d/%f,scale=%d:-2,tile=%dx%d",
+			frames, file.Media.Duration, previewWidth, columns, rows),
+	})
+	if err != nil {
+		io.Logf("Error extracting contact sheet of %s: %v", io.Warn, file.FilePath, err)
+		return false
+	}
+	return true
+}
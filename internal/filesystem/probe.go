@@ -0,0 +1,155 @@
+// This file probes source files with ffprobe and converts the output into
+// the media info stored with each job.
+package filesystem
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// probeData mirrors the parts of the ffprobe JSON output that are used
+type probeData struct {
+	Streams []struct {
+		Index          int               `json:"index"`
+		CodecType      string            `json:"codec_type"`
+		CodecName      string            `json:"codec_name"`
+		Profile        string            `json:"profile"`
+		Width          int               `json:"width"`
+		Height         int               `json:"height"`
+		AvgFrameRate   string            `json:"avg_frame_rate"`
+		RFrameRate     string            `json:"r_frame_rate"`
+		PixFmt         string            `json:"pix_fmt"`
+		Channels       int               `json:"channels"`
+		ChannelLayout  string            `json:"channel_layout"`
+		SampleRate     string            `json:"sample_rate"`
+		BitRate        string            `json:"bit_rate"`
+		Duration       string            `json:"duration"`
+		ColorSpace     string            `json:"color_space"`
+		ColorTransfer  string            `json:"color_transfer"`
+		ColorPrimaries string            `json:"color_primaries"`
+		ColorRange     string            `json:"color_range"`
+		Tags           map[string]string `json:"tags"`
+		Disposition    map[string]int    `json:"disposition"`
+		SideDataList   []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Size       string            `json:"size"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// ProbeMedia runs ffprobe on a file and returns its media info
+func ProbeMedia(filePath string) (*types.MediaInfo, error) {
+	raw, err := ffmpeg.Probe(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(raw)
+}
+
+// parseProbe converts ffprobe JSON output into media info
+func parseProbe(raw string) (*types.MediaInfo, error) {
+	var data probeData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, err
+	}
+
+	info := &types.MediaInfo{
+		Format:   data.Format.FormatName,
+		Duration: parseFloat(data.Format.Duration),
+		BitRate:  parseInt(data.Format.BitRate),
+		Size:     parseInt(data.Format.Size),
+		Timecode: data.Format.Tags["timecode"],
+		Streams:  []types.MediaStream{},
+	}
+
+	for _, s := range data.Streams {
+		stream := types.MediaStream{
+			Index:          s.Index,
+			Type:           types.StreamType(s.CodecType),
+			Codec:          s.CodecName,
+			Profile:        s.Profile,
+			Width:          s.Width,
+			Height:         s.Height,
+			PixelFormat:    s.PixFmt,
+			Channels:       s.Channels,
+			ChannelLayout:  s.ChannelLayout,
+			SampleRate:     int(parseInt(s.SampleRate)),
+			BitRate:        parseInt(s.BitRate),
+			Duration:       parseFloat(s.Duration),
+			ColorSpace:     s.ColorSpace,
+			ColorTransfer:  s.ColorTransfer,
+			ColorPrimaries: s.ColorPrimaries,
+			ColorRange:     s.ColorRange,
+			Language:       s.Tags["language"],
+			AttachedPic:    s.Disposition["attached_pic"] == 1,
+		}
+
+		if stream.Type == types.VideoStream {
+			stream.FrameRate = parseRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseRate(s.RFrameRate)
+			}
+
+			// newer ffprobe reports rotation as display matrix side data,
+			// older versions use the rotate tag
+			if rotate, ok := s.Tags["rotate"]; ok {
+				stream.Rotation = int(parseInt(rotate))
+			}
+			for _, side := range s.SideDataList {
+				if side.Rotation != 0 {
+					stream.Rotation = int(side.Rotation)
+				}
+			}
+		}
+
+		info.Streams = append(info.Streams, stream)
+		// mov and mxf sources store the start timecode on a timecode track
+		if info.Timecode == "" {
+			info.Timecode = s.Tags["timecode"]
+		}
+	}
+
+	// some containers only report duration per stream
+	if info.Duration == 0 {
+		for _, stream := range info.Streams {
+			if stream.Duration > info.Duration {
+				info.Duration = stream.Duration
+			}
+		}
+	}
+	return info, nil
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func parseInt(value string) int64 {
+	i, _ := strconv.ParseInt(value, 10, 64)
+	return i
+}
+
+// parseRate converts an ffprobe rational such as 30000/1001 to a float
+func parseRate(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+	if !found {
+		return parseFloat(value)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestParseProbe(t *testing.T) {
+	raw := `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "profile": "High", "width": 1920, "height": 1080,
+			 "avg_frame_rate": "30000/1001", "pix_fmt": "yuv420p", "bit_rate": "8000000", "duration": "60.060",
+			 "color_primaries": "bt709", "tags": {"language": "und"}},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2, "channel_layout": "stereo",
+			 "sample_rate": "48000", "bit_rate": "192000", "duration": "60.000", "tags": {"language": "eng"}},
+			{"index": 2, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+			 "avg_frame_rate": "0/0", "r_frame_rate": "90000/1", "disposition": {"attached_pic": 1}}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "60.060", "bit_rate": "8200000", "size": "61566000",
+			"tags": {"timecode": "01:00:00;00"}}
+	}`
+	info, err := parseProbe(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "mov,mp4,m4a,3gp,3g2,mj2" || info.Duration != 60.06 || info.BitRate != 8200000 || info.Size != 61566000 {
+		t.Errorf("format = %s, %v s, %d b/s, %d bytes", info.Format, info.Duration, info.BitRate, info.Size)
+	}
+	if info.Timecode != "01:00:00;00" {
+		t.Errorf("timecode = %q, want %q", info.Timecode, "01:00:00;00")
+	}
+	if len(info.Streams) != 3 {
+		t.Fatalf("got %d streams, want 3", len(info.Streams))
+	}
+
+	video := info.Streams[0]
+	want := types.MediaStream{
+		Index: 0, Type: types.VideoStream, Codec: "h264", Profile: "High", Width: 1920, Height: 1080,
+		FrameRate: 30000.0 / 1001, PixelFormat: "yuv420p", BitRate: 8000000, Duration: 60.06,
+		ColorPrimaries: "bt709", Language: "und",
+	}
+	if video != want {
+		t.Errorf("video stream = %+v, want %+v", video, want)
+	}
+	audio := info.Streams[1]
+	want = types.MediaStream{
+		Index: 1, Type: types.AudioStream, Codec: "aac", Channels: 2, ChannelLayout: "stereo",
+		SampleRate: 48000, BitRate: 192000, Duration: 60, Language: "eng",
+	}
+	if audio != want {
+		t.Errorf("audio stream = %+v, want %+v", audio, want)
+	}
+	cover := info.Streams[2]
+	if !cover.AttachedPic || cover.FrameRate != 90000 {
+		t.Errorf("cover art stream = %+v, want an attached picture at the real frame rate", cover)
+	}
+}
+
+func TestParseProbeFallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		rotation int
+		duration float64
+		timecode string
+	}{
+		{"rotate tag", `{"streams": [{"codec_type": "video", "tags": {"rotate": "90"}}], "format": {"duration": "10"}}`, 90, 10, ""},
+		{"display matrix", `{"streams": [{"codec_type": "video", "tags": {"rotate": "90"}, "side_data_list": [{}, {"rotation": -90}]}], "format": {"duration": "10"}}`, -90, 10, ""},
+		{"stream durations", `{"streams": [{"codec_type": "video", "duration": "9.5"}, {"codec_type": "audio", "duration": "10.25"}], "format": {}}`, 0, 10.25, ""},
+		{"timecode track", `{"streams": [{"codec_type": "video"}, {"codec_type": "data", "tags": {"timecode": "10:00:00:00"}}], "format": {"duration": "10"}}`, 0, 10, "10:00:00:00"},
+		{"no streams", `{"format": {"duration": "N/A"}}`, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseProbe(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rotation := 0
+			if video := info.Video(); video != nil {
+				rotation = video.Rotation
+			}
+			if rotation != tt.rotation || info.Duration != tt.duration || info.Timecode != tt.timecode {
+				t.Errorf("got rotation %d, duration %v, timecode %q, want %d, %v, %q",
+					rotation, info.Duration, info.Timecode, tt.rotation, tt.duration, tt.timecode)
+			}
+			if info.Streams == nil {
+				t.Error("streams is nil, want an empty list")
+			}
+		})
+	}
+
+	if _, err := parseProbe("not json"); err == nil {
+		t.Error("parsing invalid output returned no error")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"25/1", 25},
+		{"30000/1001", 30000.0 / 1001},
+		{"0/0", 0},
+		{"24", 24},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRate(tt.value); got != tt.want {
+			t.Errorf("parseRate(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// This file turns a preset's rate control into the ffmpeg passes of an
+// output and manages the pass log files of two-pass encodes.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	io "blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const defaultAudioBitrate = 128000 // assumed for size targets when the preset doesn't set one
+const muxOverhead = 0.98           // share of the target size left for the streams
+const minVideoBitrate = 50000      // size targets below this are refused
+
+// errInvalidRate is returned when a preset's rate control can't be applied to a source
+var errInvalidRate = errors.New("invalid rate control")
+
+// qualityOptions are the options encoders use for constant quality, in order of preference
+var qualityOptions = []string{"crf", "cq", "global_quality", "q"}
+
+// encodePass is a single ffmpeg run of an output
+type encodePass struct {
+	args    ffmpeg.KwArgs
+	outFile string
+}
+
+// ratePasses applies the preset rate control to the output arguments and
+// returns the passes needed to encode the output
+func ratePasses(preset types.PresetBundle, media *types.MediaInfo, duration float64, videoCodec string, args ffmpeg.KwArgs, outFile string, passLog string) ([]encodePass, error) {
+	rate := preset.VideoPreset.Rate
+	if rate == nil {
+		return []encodePass{{args: args, outFile: outFile}}, nil
+	}
+
+	switch rate.Mode {
+	case types.RateQuality:
+		if rate.Quality == nil {
+			return nil, fmt.Errorf("%w: quality mode requires a quality value", errInvalidRate)
+		}
+		option := qualityOptions[0]
+		for _, name := range qualityOptions {
+			if supportsOption(videoCodec, types.Video, name) {
+				option = name
+				break
+			}
+		}
+		args[option+":v"] = strconv.Itoa(*rate.Quality)
+	case types.RateCBR:
+		args["b:v"] = rate.Bitrate
+		args["minrate:v"] = rate.Bitrate
+		args["maxrate:v"] = rate.Bitrate
+		args["bufsize:v"] = valueOr(rate.BufSize, rate.Bitrate)
+	case types.RateVBR:
+		args["b:v"] = rate.Bitrate
+		args["maxrate:v"] = rate.MaxRate
+		args["bufsize:v"] = valueOr(rate.BufSize, doubleRate(rate.MaxRate))
+	case types.RateTwoPass:
+		args["b:v"] = rate.Bitrate
+	case types.RateSize:
+		bitrate, err := sizeBitrate(preset, media, duration, rate.TargetSize)
+		if err != nil {
+			return nil, err
+		}
+		args["b:v"] = strconv.FormatInt(bitrate, 10)
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %s", errInvalidRate, rate.Mode)
+	}
+	if rate.BufSize != "" {
+		args["bufsize:v"] = rate.BufSize
+	}
+
+	if !rate.TwoPass() {
+		return []encodePass{{args: args, outFile: outFile}}, nil
+	}
+
+	// the first pass only analyses the video, its output is discarded
+	first := ffmpeg.KwArgs{}
+	for key, value := range args {
+		if key == "c:a" || key == "ar" || strings.HasSuffix(key, ":a") {
+			continue
+		}
+		first[key] = value
+	}
+	if maps, ok := args["map"].([]string); ok {
+		first["map"] = videoMaps(maps)
+	}
+	first["pass"] = "1"
+	first["passlogfile"] = passLog
+	first["an"] = ""
+	first["f"] = "null"
+
+	second := ffmpeg.KwArgs{}
+	for key, value := range args {
+		second[key] = value
+	}
+	second["pass"] = "2"
+	second["passlogfile"] = passLog
+	return []encodePass{{args: first, outFile: os.DevNull}, {args: second, outFile: outFile}}, nil
+}
+
+// sizeBitrate computes the video bitrate that makes an output of the given
+// duration reach a target size, after leaving room for the audio and container
+func sizeBitrate(preset types.PresetBundle, media *types.MediaInfo, duration float64, targetSize string) (int64, error) {
+	size, err := types.ParseBitrate(targetSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: target size %s: %v", errInvalidRate, targetSize, err)
+	}
+	if media == nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: size mode requires the source duration", errInvalidRate)
+	}
+
+	audioBitrate := int64(0)
+	if media.Audio() != nil {
+		audioBitrate = defaultAudioBitrate
+		if preset.AudioPreset.Bitrate != "" {
+			audioBitrate, _ = types.ParseBitrate(preset.AudioPreset.Bitrate)
+		} else if codec, _ := preset.AudioPreset.Codec.Resolve(types.Audio); codec == types.CopyCodec && media.Audio().BitRate > 0 {
+			audioBitrate = media.Audio().BitRate
+		}
+	}
+
+	bitrate := int64(float64(size)*8*muxOverhead/duration) - audioBitrate
+	if bitrate < minVideoBitrate {
+		return 0, fmt.Errorf("%w: target size %s is too small for %.0f seconds of video", errInvalidRate, targetSize, duration)
+	}
+	return bitrate, nil
+}
+
+// passLogPrefix returns the pass log file prefix of an output, stored in the
+// data directory so logs of interrupted jobs don't end up next to the outputs
+func passLogPrefix(fileId string, output int) (string, error) {
+	dir := filepath.Join(*opts.DataDir, "passlogs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%d", fileId, output)), nil
+}
+
+// removePassLogs deletes the files written by the passes of an output
+func removePassLogs(prefix string) {
+	matches, _ := filepath.Glob(prefix + "*")
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil {
+			io.Logf("Error removing pass log %s: %v", io.Warn, path, err)
+		}
+	}
+}
+
+func valueOr(value string, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// doubleRate returns twice a bitrate in bits per second, the original value if it can't be parsed
+func doubleRate(value string) string {
+	rate, err := types.ParseBitrate(value)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatInt(rate*2, 10)
+}
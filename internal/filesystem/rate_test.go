@@ -0,0 +1,140 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// avMedia returns the media of a 100 second source with a video and an audio stream
+func avMedia() *types.MediaInfo {
+	return &types.MediaInfo{
+		Duration: 100,
+		Streams: []types.MediaStream{
+			{Index: 0, Type: types.VideoStream, Codec: "h264", Width: 1920, Height: 1080},
+			{Index: 1, Type: types.AudioStream, Codec: "aac", BitRate: 256000},
+		},
+	}
+}
+
+func ratePreset(rate *types.RateControl) types.PresetBundle {
+	return types.PresetBundle{
+		Name:        "rate",
+		VideoPreset: types.VideoPreset{Codec: types.CodecList{"libx264"}, Rate: rate},
+		AudioPreset: types.AudioPreset{Codec: types.CodecList{"aac"}},
+	}
+}
+
+func TestRatePasses(t *testing.T) {
+	quality := 23
+	tests := []struct {
+		name    string
+		rate    *types.RateControl
+		want    ffmpeg.KwArgs // arguments set on the final pass
+		passes  int
+		wantErr bool
+	}{
+		{"none", nil, ffmpeg.KwArgs{}, 1, false},
+		{"quality", &types.RateControl{Mode: types.RateQuality, Quality: &quality}, ffmpeg.KwArgs{"crf:v": "23"}, 1, false},
+		{"quality without a value", &types.RateControl{Mode: types.RateQuality}, nil, 0, true},
+		{"cbr", &types.RateControl{Mode: types.RateCBR, Bitrate: "5M"}, ffmpeg.KwArgs{"b:v": "5M", "minrate:v": "5M", "maxrate:v": "5M", "bufsize:v": "5M"}, 1, false},
+		{"vbr", &types.RateControl{Mode: types.RateVBR, Bitrate: "5M", MaxRate: "8M"}, ffmpeg.KwArgs{"b:v": "5M", "maxrate:v": "8M", "bufsize:v": "16000000"}, 1, false},
+		{"vbr with buffer", &types.RateControl{Mode: types.RateVBR, Bitrate: "5M", MaxRate: "8M", BufSize: "4M"}, ffmpeg.KwArgs{"bufsize:v": "4M"}, 1, false},
+		{"two pass", &types.RateControl{Mode: types.RateTwoPass, Bitrate: "5M"}, ffmpeg.KwArgs{"b:v": "5M", "pass": "2", "passlogfile": "log"}, 2, false},
+		{"size", &types.RateControl{Mode: types.RateSize, TargetSize: "100M"}, ffmpeg.KwArgs{"b:v": "7712000", "pass": "2"}, 2, false},
+		{"unknown mode", &types.RateControl{Mode: "crf"}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := ffmpeg.KwArgs{"c:v": "libx264", "c:a": "aac"}
+			passes, err := ratePasses(ratePreset(tt.rate), avMedia(), 100, "libx264", args, "out.mp4", "log")
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidRate) {
+					t.Fatalf("got error %v, want %v", err, errInvalidRate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(passes) != tt.passes {
+				t.Fatalf("got %d passes, want %d", len(passes), tt.passes)
+			}
+			last := passes[len(passes)-1]
+			if last.outFile != "out.mp4" {
+				t.Errorf("final pass writes %s, want out.mp4", last.outFile)
+			}
+			for key, value := range tt.want {
+				if last.args[key] != value {
+					t.Errorf("%s = %v, want %v", key, last.args[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRatePassesAnalysis(t *testing.T) {
+	args := ffmpeg.KwArgs{"c:v": "libx264", "c:a": "aac", "b:a": "192k", "map": []string{"0:v:0", "0:a:0"}}
+	passes, err := ratePasses(ratePreset(&types.RateControl{Mode: types.RateTwoPass, Bitrate: "5M"}), avMedia(), 100, "libx264", args, "out.mp4", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the analysis pass drops the audio and discards its output
+	first := passes[0]
+	if first.outFile != os.DevNull {
+		t.Errorf("analysis pass writes %s, want %s", first.outFile, os.DevNull)
+	}
+	want := ffmpeg.KwArgs{"c:v": "libx264", "b:v": "5M", "map": []string{"0:v:0"}, "pass": "1", "passlogfile": "log", "an": "", "f": "null"}
+	if !reflect.DeepEqual(first.args, want) {
+		t.Errorf("analysis pass args = %v, want %v", first.args, want)
+	}
+	if maps := passes[1].args["map"]; !reflect.DeepEqual(maps, []string{"0:v:0", "0:a:0"}) {
+		t.Errorf("encoding pass maps = %v, want the audio kept", maps)
+	}
+}
+
+func TestSizeBitrate(t *testing.T) {
+	videoOnly := &types.MediaInfo{Duration: 100, Streams: avMedia().Streams[:1]}
+	tests := []struct {
+		name     string
+		audio    types.AudioPreset
+		media    *types.MediaInfo
+		duration float64
+		size     string
+		want     int64
+		wantErr  bool
+	}{
+		{"default audio bitrate", types.AudioPreset{Codec: types.CodecList{"aac"}}, avMedia(), 100, "100M", 7712000, false},
+		{"preset audio bitrate", types.AudioPreset{Codec: types.CodecList{"aac"}, Bitrate: "192k"}, avMedia(), 100, "100M", 7648000, false},
+		{"copied audio", types.AudioPreset{Codec: types.CodecList{types.CopyCodec}}, avMedia(), 100, "100M", 7584000, false},
+		{"no audio", types.AudioPreset{Codec: types.CodecList{"aac"}}, videoOnly, 100, "100M", 7840000, false},
+		{"too small", types.AudioPreset{}, avMedia(), 100, "1M", 0, true},
+		{"unknown duration", types.AudioPreset{}, avMedia(), 0, "100M", 0, true},
+		{"unprobed", types.AudioPreset{}, nil, 100, "100M", 0, true},
+		{"invalid size", types.AudioPreset{}, avMedia(), 100, "large", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset := types.PresetBundle{AudioPreset: tt.audio}
+			got, err := sizeBitrate(preset, tt.media, tt.duration, tt.size)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidRate) {
+					t.Errorf("got error %v, want %v", err, errInvalidRate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sizeBitrate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// This file classifies failed conversions and schedules retries with
+// backoff for failures that may succeed on another attempt.
+package filesystem
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	io "blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+const stderrTailSize = 4096 // bytes of ffmpeg error output kept for classification
+
+// failurePatterns maps ffmpeg error output to a failure reason, checked in order
+var failurePatterns = []struct {
+	reason   types.FailureReason
+	patterns []string
+}{
+	{types.DiskFull, []string{"no space left on device", "disk quota exceeded"}},
+	{types.DeviceBusy, busyDeviceErrors},
+	{types.EncoderMissing, append([]string{"unknown encoder", "encoder not found"}, deviceErrors...)},
+	{types.InputUnreadable, []string{
+		"no such file or directory",
+		"invalid data found when processing input",
+		"moov atom not found",
+		"could not find codec parameters",
+		"error opening input",
+		"permission denied",
+	}},
+}
+
+// deviceErrors are reported when a hardware encoder has no usable device,
+// ffmpeg reports most of them without naming the encoder
+var deviceErrors = []string{
+	"no nvenc capable devices found",
+	"cannot load libcuda",
+	"cannot load nvcuda",
+	"failed to initialise vaapi",
+	"no device available for encoder",
+}
+
+// busyDeviceErrors are reported when a hardware encoder is out of sessions or
+// memory, they clear up once other encodes release the device
+var busyDeviceErrors = []string{
+	"openencodesessionex failed",
+	"device or resource busy",
+}
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = append(t.data, p...)
+	if len(t.data) > t.limit {
+		t.data = t.data[len(t.data)-t.limit:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.data)
+}
+
+// conversionError is returned when ffmpeg exits with an error
+type conversionError struct {
+	err    error
+	stderr string
+}
+
+func (e *conversionError) Error() string {
+	lines := strings.Split(strings.TrimSpace(e.stderr), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last + " (" + e.err.Error() + ")"
+	}
+	return e.err.Error()
+}
+
+func (e *conversionError) Unwrap() error {
+	return e.err
+}
+
+// classifyFailure determines the reason a conversion failed
+func classifyFailure(err error) types.FailureReason {
+	if errors.Is(err, syscall.ENOSPC) {
+		return types.DiskFull
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, errNoEncoder) {
+		return types.EncoderMissing
+	}
+	if errors.Is(err, errInvalidRate) || errors.Is(err, errInvalidPackaging) || errors.Is(err, errMissingStream) {
+		return types.InvalidPreset
+	}
+
+	msg := failureMessage(err)
+	for _, class := range failurePatterns {
+		if containsAny(msg, class.patterns) {
+			return class.reason
+		}
+	}
+	return types.UnknownFailure
+}
+
+// failureMessage returns the lower-cased error and ffmpeg error output of a failure
+func failureMessage(err error) string {
+	msg := strings.ToLower(err.Error())
+	var convErr *conversionError
+	if errors.As(err, &convErr) {
+		msg += "\n" + strings.ToLower(convErr.stderr)
+	}
+	return msg
+}
+
+func containsAny(msg string, patterns []string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool { return strings.Contains(msg, pattern) })
+}
+
+// retryBackoff returns the delay before a retry, doubled for each attempt
+func retryBackoff(attempt int) time.Duration {
+	backoff := time.Duration(*opts.RetryBackoff) * time.Second
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+	}
+	if backoff < time.Second {
+		backoff = time.Second
+	}
+	return backoff
+}
+
+// recordFailure stores the reason an output failed and counts the attempt
+func recordFailure(fileId string, output int, reason types.FailureReason, err error) (types.File, bool) {
+	return store.ModifyFile(fileId, func(file *types.File) {
+		if output < 0 || output >= len(file.Outputs) {
+			return
+		}
+		file.Outputs = append([]types.Output{}, file.Outputs...)
+		file.Outputs[output].Reason = reason
+		if err != nil {
+			file.Outputs[output].Attempts++
+			file.Outputs[output].Error = err.Error()
+			file.Error = err.Error()
+		}
+	})
+}
+
+// handleFailure records a failed output and resets it for a retry if the
+// failure is transient and retries remain, returning the delay before the retry
+func handleFailure(fileId string, output int, err error) (time.Duration, bool) {
+	reason := classifyFailure(err)
+	file, ok := recordFailure(fileId, output, reason, err)
+	if !ok || output < 0 || output >= len(file.Outputs) {
+		return 0, false
+	}
+
+	attempts := file.Outputs[output].Attempts
+	if !reason.Transient() || attempts > *opts.MaxRetries {
+		io.Logf("Conversion failed (%s) after %d attempt(s): %s", io.Error, reason, attempts, file.FilePath)
+		updateProgress(fileId, output, -1, true)
+		return 0, false
+	}
+
+	backoff := retryBackoff(attempts)
+	io.Logf("Conversion failed (%s), retry %d/%d in %v: %s", io.Warn, reason, attempts, *opts.MaxRetries, backoff, file.FilePath)
+	file, ok = store.ModifyFile(fileId, func(f *types.File) {
+		if output >= len(f.Outputs) {
+			return
+		}
+		f.Outputs = append([]types.Output{}, f.Outputs...)
+		f.Outputs[output].Status = types.Queued
+		f.Outputs[output].Progress = 0
+		f.Summarize()
+	})
+	if !ok {
+		return 0, false
+	}
+	broadcastFile(file, true)
+	return backoff, true
+}
+
+// scheduleRetry puts a file back in the queue once the backoff has passed
+func scheduleRetry(fileId string, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		file, ok := store.GetFile(fileId)
+		if !ok || file.Status == types.Cancelled {
+			return
+		}
+		if !store.Enqueue(file) {
+			io.Logf("Retry skipped, file is already queued: %s", io.Debug, file.FilePath)
+		}
+	})
+}
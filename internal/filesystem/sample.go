@@ -0,0 +1,183 @@
+// This file encodes short samples of a source with a preset, so the colour,
+// scaling and audio of a preset can be checked before the full conversion.
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/u2takey/go-utils/uuid"
+
+	io "blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const sampleLifetime = 15 * time.Minute // preview encodes are deleted after this
+
+// EncodeSample encodes a short section of a file with a preset into a
+// temporary location, blocking until the preview is written; the encode takes
+// a conversion slot and is cancelled when the context is done
+func EncodeSample(ctx context.Context, fileId string, req types.SampleRequest) (types.Sample, error) {
+	file, ok := store.GetFile(fileId)
+	if !ok {
+		return types.Sample{}, types.ErrFileNotFound
+	}
+	preset, err := samplePreset(file, req.Preset)
+	if err != nil {
+		return types.Sample{}, err
+	}
+	if file.Media == nil {
+		media, err := Backend.Probe(file.FilePath)
+		if err != nil {
+			return types.Sample{}, err
+		}
+		file.SetMedia(media)
+	}
+
+	if err := checkStreams(preset, file.Media); err != nil {
+		return types.Sample{}, err
+	}
+	preset = cropPreset(preset, file)
+
+	// the sample defaults to the start of the range the job converts
+	start := types.Timecode(0)
+	if file.Trim != nil {
+		start = file.Trim.In
+	}
+	if req.Start != nil {
+		start = *req.Start
+	}
+	length := req.Length
+	if length <= 0 {
+		length = types.Timecode(*opts.PreviewLength)
+	}
+	section := types.Trim{In: start, Out: start + length}
+	if err := section.Validate(file.SourceDuration()); err != nil {
+		return types.Sample{}, err
+	}
+	duration := section.Length(file.SourceDuration())
+
+	sample := types.Sample{
+		ID:      uuid.NewUUID(),
+		FileID:  file.ID,
+		Preset:  preset.Name,
+		Start:   start,
+		Length:  types.Timecode(duration),
+		Expires: time.Now().Add(sampleLifetime),
+	}
+	sample.URL = "/api/previews/" + sample.ID
+	ext := strings.TrimPrefix(preset.Extension, ".")
+	if ext == "" {
+		ext = types.DefaultPreset.Extension
+	}
+	sample.FilePath = filepath.Join(store.SampleDir(), sample.ID+"."+ext)
+	if err := os.MkdirAll(store.SampleDir(), 0755); err != nil {
+		return types.Sample{}, err
+	}
+
+	// samples share the conversion pool, so previews can't overload the machine
+	if err := store.AcquireSlotContext(ctx); err != nil {
+		return types.Sample{}, err
+	}
+	defer store.ReleaseSlot()
+	stop := context.AfterFunc(ctx, func() { Backend.Cancel(sample.ID) })
+	defer stop()
+
+	video, audio, err := encodeSample(ctx, file, preset, sample, duration)
+	if err != nil {
+		os.Remove(sample.FilePath)
+		if ctx.Err() != nil {
+			return types.Sample{}, ctx.Err()
+		}
+		return types.Sample{}, err
+	}
+	sample.VideoEncoder, sample.AudioEncoder = video, audio
+	store.AddSample(sample)
+	io.Logf("Encoded preview of %s with preset %s: %s", io.Info, file.FilePath, preset.Name, sample.FilePath)
+	return sample, nil
+}
+
+// samplePreset returns the requested preset, or the preset of the first output
+func samplePreset(file types.File, name string) (types.PresetBundle, error) {
+	if name == "" && len(file.Outputs) > 0 {
+		name = file.Outputs[0].Preset
+	}
+	if name == "" {
+		return resolvePreset(file.ID), nil
+	}
+	preset, ok := types.GetPreset(name)
+	if !ok {
+		return types.PresetBundle{}, fmt.Errorf("%w: %s", types.ErrPresetNotFound, name)
+	}
+	return preset, nil
+}
+
+// encodeSample runs the passes of a preset over the sample section, moving on
+// to the next encoder candidate like a conversion does
+func encodeSample(ctx context.Context, file types.File, preset types.PresetBundle, sample types.Sample, duration float64) (string, string, error) {
+	for {
+		videoCodec, audioCodec, err := resolveEncoders(preset)
+		if err != nil {
+			return "", "", err
+		}
+		err = runSamplePasses(file, preset, sample, duration, videoCodec, audioCodec)
+		if err == nil {
+			return videoCodec, audioCodec, nil
+		}
+		// a cancelled sample says nothing about the encoders
+		if ctx.Err() != nil || !markFailedEncoders(videoCodec, audioCodec, err) {
+			return "", "", err
+		}
+	}
+}
+
+func runSamplePasses(file types.File, preset types.PresetBundle, sample types.Sample, duration float64, videoCodec string, audioCodec string) error {
+	ffmpegArgs := presetArgs(preset, videoCodec, audioCodec)
+	if err := streamArgs(preset, file.Media, &types.Trim{In: sample.Start}, ffmpegArgs); err != nil {
+		return err
+	}
+	filterArgs(preset, file.Media, ffmpegArgs)
+	subtitles, err := subtitleArgs(preset, file, &types.Trim{In: sample.Start}, ffmpegArgs)
+	if err != nil {
+		return err
+	}
+	ffmpegArgs["t"] = types.Timecode(duration).String()
+
+	passLog := ""
+	if preset.VideoPreset.Rate.TwoPass() {
+		var err error
+		if passLog, err = passLogPrefix(sample.ID, 0); err != nil {
+			return err
+		}
+		defer removePassLogs(passLog)
+	}
+	// target sizes apply to the whole job, so the sample gets the bitrate of the full conversion
+	passes, err := ratePasses(preset, file.Media, file.Duration, videoCodec, ffmpegArgs, sample.FilePath, passLog)
+	if err != nil {
+		return err
+	}
+	for _, p := range passes {
+		// samples are keyed by their own ID so they can run next to the file's conversion
+		job := TranscodeJob{
+			FileID:    sample.ID,
+			InFile:    file.FilePath,
+			OutFile:   p.outFile,
+			InputArgs: ffmpeg.KwArgs{"ss": sample.Start.String()},
+			Subtitles: subtitles,
+			Args:      p.args,
+			Duration:  duration,
+		}
+		if err := Backend.Run(job, func(progress float32) {}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// This file converts preset scale rules into ffmpeg video filters based on
+// the probed size of the source.
+package filesystem
+
+import (
+	"fmt"
+	"math"
+
+	types "blockbuffer/internal/types"
+)
+
+const defaultRounding = 2 // most encoders require even dimensions
+
+// scaleFilter returns the filter chain that applies a scale rule to the
+// source video, empty if the source can be encoded at its current size
+func scaleFilter(media *types.MediaInfo, rule *types.ScaleRule) string {
+	video := media.Video()
+	if video == nil {
+		return ""
+	}
+	srcW, srcH := video.DisplaySize()
+	if srcW <= 0 || srcH <= 0 {
+		return ""
+	}
+
+	mode := types.ScaleKeep
+	targetW, targetH, minW, minH, rounding := 0, 0, 0, 0, defaultRounding
+	if rule != nil {
+		if rule.Mode != "" {
+			mode = rule.Mode
+		}
+		targetW, targetH, minW, minH = rule.Width, rule.Height, rule.MinWidth, rule.MinHeight
+		if rule.Rounding >= 2 {
+			rounding = rule.Rounding
+		}
+		// targets are written for landscape sources, portrait sources use them rotated
+		if rule.MatchOrientation && srcH > srcW {
+			targetW, targetH = targetH, targetW
+			minW, minH = minH, minW
+		}
+	}
+
+	w, h := float64(srcW), float64(srcH)
+	switch mode {
+	case types.ScaleMax:
+		factor := 1.0
+		if targetW > 0 {
+			factor = math.Min(factor, float64(targetW)/w)
+		}
+		if targetH > 0 {
+			factor = math.Min(factor, float64(targetH)/h)
+		}
+		w, h = w*factor, h*factor
+	case types.ScaleFit, types.ScalePad:
+		factor := math.Min(float64(targetW)/w, float64(targetH)/h)
+		w, h = w*factor, h*factor
+	case types.ScaleFill:
+		factor := math.Max(float64(targetW)/w, float64(targetH)/h)
+		w, h = w*factor, h*factor
+	}
+
+	// upscale sources below the minimum size, keeping the aspect ratio
+	if mode == types.ScaleKeep || mode == types.ScaleMax {
+		factor := 1.0
+		if minW > 0 && w < float64(minW) {
+			factor = math.Max(factor, float64(minW)/w)
+		}
+		if minH > 0 && h < float64(minH) {
+			factor = math.Max(factor, float64(minH)/h)
+		}
+		w, h = w*factor, h*factor
+	}
+
+	outW, outH := roundTo(w, rounding), roundTo(h, rounding)
+	switch mode {
+	case types.ScaleFill:
+		cropW, cropH := roundTo(float64(targetW), rounding), roundTo(float64(targetH), rounding)
+		outW, outH = max(outW, cropW), max(outH, cropH)
+		return fmt.Sprintf("scale=%d:%d,setsar=1,crop=%d:%d", outW, outH, cropW, cropH)
+	case types.ScalePad:
+		padW, padH := roundTo(float64(targetW), rounding), roundTo(float64(targetH), rounding)
+		outW, outH = min(outW, padW), min(outH, padH)
+		return fmt.Sprintf("scale=%d:%d,setsar=1,pad=%d:%d:(ow-iw)/2:(oh-ih)/2", outW, outH, padW, padH)
+	}
+
+	if outW == srcW && outH == srcH {
+		return ""
+	}
+	return fmt.Sprintf("scale=%d:%d,setsar=1", outW, outH)
+}
+
+// roundTo rounds a dimension to the nearest multiple, never returning less than the multiple
+func roundTo(value float64, multiple int) int {
+	rounded := int(math.Round(value/float64(multiple))) * multiple
+	if rounded < multiple {
+		return multiple
+	}
+	return rounded
+}
@@ -0,0 +1,64 @@
+package filesystem
+
+import (
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+// videoMedia returns the media of a source with a single video stream
+func videoMedia(width int, height int, rotation int) *types.MediaInfo {
+	return &types.MediaInfo{
+		Duration: 10,
+		Streams: []types.MediaStream{
+			{Index: 0, Type: types.VideoStream, Codec: "h264", Width: width, Height: height, Rotation: rotation, FrameRate: 25},
+		},
+	}
+}
+
+func TestScaleFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		media *types.MediaInfo
+		rule  *types.ScaleRule
+		want  string
+	}{
+		{"no rule", videoMedia(1920, 1080, 0), nil, ""},
+		{"no video", &types.MediaInfo{}, &types.ScaleRule{Mode: types.ScaleFit, Width: 1280, Height: 720}, ""},
+		{"max shrinks", videoMedia(1920, 1080, 0), &types.ScaleRule{Mode: types.ScaleMax, Width: 1280, Height: 720}, "scale=1280:720,setsar=1"},
+		{"max never upscales", videoMedia(1280, 720, 0), &types.ScaleRule{Mode: types.ScaleMax, Width: 1920}, ""},
+		{"fit", videoMedia(1920, 1080, 0), &types.ScaleRule{Mode: types.ScaleFit, Width: 1280, Height: 1280}, "scale=1280:720,setsar=1"},
+		{"fill crops the overflow", videoMedia(1920, 1080, 0), &types.ScaleRule{Mode: types.ScaleFill, Width: 1080, Height: 1080}, "scale=1920:1080,setsar=1,crop=1080:1080"},
+		{"pad", videoMedia(1920, 1080, 0), &types.ScaleRule{Mode: types.ScalePad, Width: 1280, Height: 1280}, "scale=1280:720,setsar=1,pad=1280:1280:(ow-iw)/2:(oh-ih)/2"},
+		{"minimum upscales", videoMedia(640, 360, 0), &types.ScaleRule{Mode: types.ScaleKeep, MinWidth: 1280, MinHeight: 720}, "scale=1280:720,setsar=1"},
+		{"matched orientation", videoMedia(1080, 1920, 0), &types.ScaleRule{Mode: types.ScaleMax, Width: 1280, Height: 720, MatchOrientation: true}, "scale=720:1280,setsar=1"},
+		{"rotated source", videoMedia(1920, 1080, 90), &types.ScaleRule{Mode: types.ScaleMax, Width: 1280, Height: 720}, "scale=406:720,setsar=1"},
+		{"rounding", videoMedia(1920, 1080, 0), &types.ScaleRule{Mode: types.ScaleMax, Width: 1000, Rounding: 16}, "scale=1008:560,setsar=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scaleFilter(tt.media, tt.rule); got != tt.want {
+				t.Errorf("scaleFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTo(t *testing.T) {
+	tests := []struct {
+		value    float64
+		multiple int
+		want     int
+	}{
+		{719.4, 2, 720},
+		{3, 2, 4},
+		{1, 2, 2},
+		{0.4, 16, 16},
+		{562.5, 16, 560},
+	}
+	for _, tt := range tests {
+		if got := roundTo(tt.value, tt.multiple); got != tt.want {
+			t.Errorf("roundTo(%v, %d) = %d, want %d", tt.value, tt.multiple, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package filesystem
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/fsnotify/fsnotify"
@@ -12,59 +13,247 @@ import (
 
 	api "blockbuffer/internal/api"
 	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
 	store "blockbuffer/internal/store"
 	types "blockbuffer/internal/types"
 )
 
-var skipList = make(map[string]bool)
-var PresetBindings = make(map[string]string)
-var GlobalBinding string
+var videoExtensions = []string{".mp4", ".mov", ".avi", ".mkv"}
+var audioExtensions = []string{".wav", ".flac", ".mp3", ".aac", ".m4a", ".ogg", ".opus", ".aif", ".aiff"}
 
-// isVideoFile checks if a file is a supported video format (case-insensitive)
-func isVideoFile(filePath string) bool {
+// isMediaFile checks if a file is a supported video or audio format (case-insensitive)
+func isMediaFile(filePath string) bool {
 	// Convert file extension to lowercase for case-insensitive comparison
 	ext := strings.ToLower(filepath.Ext(filePath))
-	return ext == ".mp4" || ext == ".mov" || ext == ".avi" || ext == ".mkv"
+	return slices.Contains(videoExtensions, ext) || slices.Contains(audioExtensions, ext)
 }
 
-func ScanAndQueueFiles(inputDir string, outputDir string) {
-	files, err := os.ReadDir(inputDir)
+// newFile creates a job for a source file found in a hot folder
+func newFile(filePath string, folder types.HotFolder) types.File {
+	var media = PollFile(filePath)
+	file := types.File{
+		ID:        uuid.NewUUID(),
+		FilePath:  filePath,
+		WatchDir:  folder.WatchDir,
+		HotFolder: folder.Name,
+		Status:    types.Queued,
+		Progress:  0,
+		Subtitles: findSubtitleFiles(filePath),
+	}
+	file.SetMedia(media)
+	if trim := store.TakePendingTrim(filePath); trim != nil {
+		if err := trim.Validate(file.SourceDuration()); err != nil {
+			io.Logf("Ignoring trim of %s: %v", io.Warn, filePath, err)
+		} else {
+			file.SetTrim(trim)
+		}
+	}
+	outputs, err := planOutputs(file)
 	if err != nil {
-		io.Logf("Error reading directory: %v", io.Error, err)
-	}
-
-	for _, file := range files {
-		if !file.IsDir() && isVideoFile(file.Name()) {
-			inputFile := file.Name()
-			var filePath = inputDir + "/" + inputFile
-			var totalDuration = PollFile(filePath)
-
-			outputFile := strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + "_dnxhr.mov"
-			outputPath := filepath.Join(outputDir, outputFile)
-			file := types.File{
-				ID:       uuid.NewUUID(),
-				FilePath: filePath,
-				Duration: totalDuration,
-				Status:   types.Queued,
-				Progress: 0,
+		io.Logf("Not converting %s: %v", io.Error, filePath, err)
+		file.Status = types.Failed
+		file.Error = err.Error()
+	}
+	file.Outputs = outputs
+	return file
+}
+
+func ScanAndQueueFiles(folder types.HotFolder) {
+	for _, filePath := range findMediaFiles(folder.WatchDir) {
+		inputFile := filepath.Base(filePath)
+		// files restored from the job store are already tracked
+		if _, ok := store.FindFileByPath(filePath); ok {
+			continue
+		}
+
+		file := newFile(filePath, folder)
+		store.UpdateFile(file)
+		generatePreviews(file)
+
+		if file.Status == types.Failed {
+			continue
+		}
+		if !outputsExist(file.Outputs) {
+			io.Logf("Queueing file for conversion: %s", io.Info, inputFile)
+			store.Enqueue(file)
+			detectCropInBackground(file)
+		} else {
+			io.Logf("Output files already exist: %s", io.Info, inputFile)
+			for i := range file.Outputs {
+				file.Outputs[i].Status = types.Completed
+				file.Outputs[i].Progress = 100
 			}
+			file.Summarize()
 			store.UpdateFile(file)
+		}
+	}
+}
 
-			if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-				io.Logf("Queueing file for conversion: %s", io.Info, inputFile)
-				store.FileQueue <- file
-			} else {
-				io.Logf("Output file already exists: %s", io.Info, outputFile)
-				file.Status = types.Completed
-				file.Progress = 100
-				store.UpdateFile(file)
+// findMediaFiles lists the media files in a directory, including
+// subdirectories when scanning recursively
+func findMediaFiles(dir string) []string {
+	var found []string
+	err := filepath.WalkDir(dir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			io.Logf("Error reading directory: %v", io.Error, err)
+			return nil
+		}
+		if entry.IsDir() {
+			if filePath != dir && (!*opts.Recursive || skipDir(filePath)) {
+				return filepath.SkipDir
 			}
+			return nil
 		}
+		if isMediaFile(filePath) {
+			found = append(found, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		io.Logf("Error scanning directory %s: %v", io.Error, dir, err)
 	}
+	return found
+}
+
+// skipDir checks if a directory is excluded from recursive scanning, hidden
+// directories, output directories and other hot folders nested in the watch
+// directory are skipped
+func skipDir(dir string) bool {
+	if strings.HasPrefix(filepath.Base(dir), ".") {
+		return true
+	}
+	excluded := []string{*opts.UploadDir, *opts.DataDir}
+	for _, folder := range types.ListHotFolders() {
+		excluded = append(excluded, folder.WatchDir, folder.OutputDir)
+	}
+	for _, path := range excluded {
+		if samePath(dir, path) {
+			return true
+		}
+	}
+	for _, rule := range types.GetOutputRules() {
+		if rule.OutputDir != "" && samePath(dir, rule.OutputDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePath compares two paths after resolving them to absolute paths
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// isActive checks if a tracked file with the given path is waiting or converting
+func isActive(filePath string) bool {
+	file, ok := store.FindFileByPath(filePath)
+	if !ok {
+		return false
+	}
+	switch file.Status {
+	case types.Queued, types.Processing, types.Paused:
+		return true
+	}
+	return false
+}
+
+// queueNewFile creates a job for a file detected by the watcher and announces it to clients
+func queueNewFile(filePath string, folder types.HotFolder) {
+	io.Logf("Detected new file: %s", io.Info, filePath)
+	file := newFile(filePath, folder)
+	store.UpdateFile(file)
+	// files without outputs are tracked as failed, not queued
+	if file.Status != types.Failed {
+		store.Enqueue(file)
+	}
+	api.BroadcastMessage(types.Message{
+		MessageType: types.CreateFile,
+		MustSend:    true,
+		Data:        map[string]types.File{file.ID: file},
+	})
+	generatePreviews(file)
+	detectCropInBackground(file)
+}
+
+// isUnder reports whether path is dir itself or a path inside it
+func isUnder(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
 }
 
-// WatchDirectory watches the directory for new video files and triggers conversion to DNxHR
-func WatchDirectory(inputDir string, outputDir string) {
+// watchTree adds a directory and, when watching recursively, its
+// subdirectories to the watcher
+func watchTree(watcher *fsnotify.Watcher, dir string) {
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if path != dir && (!*opts.Recursive || skipDir(path)) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			io.Logf("Error adding directory to watcher: %v", io.Error, err)
+		}
+		return nil
+	})
+	if err != nil {
+		io.Logf("Error watching directory %s: %v", io.Error, dir, err)
+	}
+}
+
+// outputsExist checks if every output of a file has already been written
+func outputsExist(outputs []types.Output) bool {
+	if len(outputs) == 0 {
+		return false
+	}
+	for _, output := range outputs {
+		if _, err := os.Stat(output.FilePath); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// RequeueRestoredJobs puts jobs restored from the job store back in the queue,
+// jobs interrupted while processing restart their unfinished outputs
+func RequeueRestoredJobs() {
+	for _, file := range store.RestoredQueue() {
+		if _, err := os.Stat(file.FilePath); err != nil {
+			io.Logf("Restored job source is missing: %s", io.Warn, file.FilePath)
+			store.ModifyFile(file.ID, func(f *types.File) {
+				f.Status = types.Failed
+				f.Error = "source file missing after restart"
+			})
+			continue
+		}
+
+		// remove partial outputs left by the interrupted conversion
+		for _, output := range file.Outputs {
+			if output.Status == types.Processing || output.Status == types.Paused {
+				io.Logf("Removing incomplete file: %s", io.Info, output.FilePath)
+				removeOutput(output)
+			}
+		}
+
+		file, _ = store.ModifyFile(file.ID, func(f *types.File) {
+			f.Outputs = append([]types.Output{}, f.Outputs...)
+			for i := range f.Outputs {
+				if f.Outputs[i].Status == types.Processing || f.Outputs[i].Status == types.Paused {
+					f.Outputs[i].Status = types.Queued
+					f.Outputs[i].Progress = 0
+				}
+			}
+			f.Status = types.Queued
+		})
+		io.Logf("Re-queueing restored job: %s", io.Info, file.FilePath)
+		store.Enqueue(file)
+	}
+}
+
+// WatchDirectory watches a hot folder for new media files and queues them for conversion
+func WatchDirectory(folder types.HotFolder) {
+	inputDir := folder.WatchDir
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		io.Logf("Error creating watcher: %v", io.Fatal, err)
@@ -75,6 +264,7 @@ func WatchDirectory(inputDir string, outputDir string) {
 	if err != nil {
 		io.Logf("Error adding directory to watcher: %v", io.Fatal, err)
 	}
+	watchTree(watcher, inputDir)
 
 	// Watch for events in the directory
 	for {
@@ -82,50 +272,43 @@ func WatchDirectory(inputDir string, outputDir string) {
 		case event := <-watcher.Events:
 			// Create is triggered when a new file is created AND not Rename
 			if event.Op.Has(fsnotify.Create) {
-				// When a new file is created, process it if it's a video file
-				if isVideoFile(event.Name) {
-					io.Logf("Detected new video: %s", io.Info, event.Name)
-					var totalDuration = PollFile(event.Name)
-					file := types.File{
-						ID:       uuid.NewUUID(),
-						FilePath: event.Name,
-						Status:   types.Queued,
-						Duration: totalDuration,
-						Progress: 0,
+				// New directories are watched and scanned, files may have been
+				// written into them before the watch was added
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if *opts.Recursive && !skipDir(event.Name) {
+						watchTree(watcher, event.Name)
+						for _, filePath := range findMediaFiles(event.Name) {
+							if _, ok := store.FindFileByPath(filePath); !ok {
+								queueNewFile(filePath, folder)
+							}
+						}
 					}
-					store.FileQueue <- file
-					store.UpdateFile(file)
-					api.BroadcastMessage(types.Message{
-						MessageType: types.CreateFile,
-						MustSend:    true,
-						Data:        map[string]types.File{file.ID: file},
-					})
-
-					// remove file from skip list
-					delete(skipList, file.ID)
+				} else if isMediaFile(event.Name) && !isActive(event.Name) {
+					// When a new file is created, process it if it's a media file
+					queueNewFile(event.Name, folder)
 				}
 			}
 			if event.Op.Has(fsnotify.Rename) || event.Op.Has(fsnotify.Remove) {
-				io.Logf("Detected renamed/removed video: %s", io.Info, event.Name)
-				// add file to skip list
-				// search for the file path in the fileList.FilePath
-				for _, file := range store.FileList {
-					if file.FilePath == event.Name {
-						io.Logf("canceling conversion: %s", io.Info, file.ID)
-						CancelConversion(file.ID)
-						skipList[file.ID] = true
-						if file.Status == types.CompleteDeleted {
-							io.Logf("Skipping UI notification: %s", io.Info, file.ID)
-							break
-						}
-						api.BroadcastMessage(types.Message{
-							MessageType: types.DeleteFile,
-							MustSend:    true,
-							Data:        map[string]types.File{file.ID: file},
-						})
-						delete(store.FileList, file.ID)
-						break
+				io.Logf("Detected renamed/removed file: %s", io.Info, event.Name)
+				// removing the file drops its queued job, convertFile skips
+				// jobs that are no longer tracked. A removed or renamed
+				// directory takes the jobs of every file below it along
+				for _, file := range store.Files() {
+					if !isUnder(file.FilePath, event.Name) {
+						continue
+					}
+					io.Logf("canceling conversion: %s", io.Info, file.ID)
+					CancelConversion(file.ID)
+					if file.Status == types.CompleteDeleted {
+						io.Logf("Skipping UI notification: %s", io.Info, file.ID)
+						continue
 					}
+					api.BroadcastMessage(types.Message{
+						MessageType: types.DeleteFile,
+						MustSend:    true,
+						Data:        map[string]types.File{file.ID: file},
+					})
+					store.RemoveFile(file.ID)
 				}
 			}
 		case err := <-watcher.Errors:
@@ -0,0 +1,98 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	opts "blockbuffer/internal/settings"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+)
+
+func TestRequeueRestoredJobs(t *testing.T) {
+	folder := types.GetHotFolder(types.DefaultHotFolder)
+	source := filepath.Join(folder.WatchDir, "restored.mp4")
+	if err := os.WriteFile(source, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a job interrupted while converting, with the partial output it left behind
+	interrupted := newFile(source, folder)
+	interrupted.Outputs[0].Status = types.Processing
+	interrupted.Outputs[0].Progress = 60
+	interrupted.Summarize()
+	if err := os.WriteFile(interrupted.Outputs[0].FilePath, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := types.File{ID: "restored-missing", FilePath: filepath.Join(*opts.WatchDir, "gone.mp4"), HotFolder: folder.Name, Status: types.Queued}
+	for _, file := range []types.File{interrupted, missing} {
+		store.UpdateFile(file)
+		t.Cleanup(func() { store.RemoveFile(file.ID) })
+	}
+
+	RequeueRestoredJobs()
+
+	file := waitFor(t, interrupted.ID, "completion", hasStatus(types.Completed))
+	if n := jobsFor(file.ID); n != 1 {
+		t.Errorf("ran %d jobs, want 1", n)
+	}
+	if data, err := os.ReadFile(file.Outputs[0].FilePath); err != nil || string(data) == "partial" {
+		t.Errorf("the partial output was not replaced: %q, %v", data, err)
+	}
+
+	gone, _ := store.GetFile(missing.ID)
+	if gone.Status != types.Failed || gone.Error == "" || store.IsPending(missing.ID) {
+		t.Errorf("job without a source is %s (%q), want failed and not queued", gone.Status, gone.Error)
+	}
+}
+
+func TestWatchRemovesJobsBelowRemovedDirectories(t *testing.T) {
+	folder := watchFolder(t, "removed-dirs", []string{"MP4"})
+	messages := subscribe(t)
+
+	// a file sharing the directory name is not inside it
+	sibling := filepath.Join(folder.WatchDir, "season.mp4")
+	dropSource(t, sibling)
+
+	var jobs []types.File
+	for _, path := range []string{"season/e01.mp4", "season/extras/e01.mp4", "samples/a.mp4"} {
+		path = filepath.Join(folder.WatchDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file := newFile(path, folder)
+		store.UpdateFile(file)
+		store.Enqueue(file)
+		t.Cleanup(func() { store.RemoveFile(file.ID) })
+		jobs = append(jobs, file)
+	}
+
+	// renaming a directory out of the watch directory and deleting one both
+	// drop the jobs of the files below them
+	if err := os.Rename(filepath.Join(folder.WatchDir, "season"), filepath.Join(t.TempDir(), "season")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(folder.WatchDir, "samples")); err != nil {
+		t.Fatal(err)
+	}
+	remaining := map[string]bool{}
+	for _, job := range jobs {
+		remaining[job.ID] = true
+	}
+	for len(remaining) > 0 {
+		file := waitForMessage(t, messages, types.DeleteFile, func(file types.File) bool { return remaining[file.ID] })
+		delete(remaining, file.ID)
+	}
+	for _, job := range jobs {
+		if _, ok := store.GetFile(job.ID); ok || store.IsPending(job.ID) {
+			t.Errorf("%s is still tracked after its directory was removed", job.FilePath)
+		}
+	}
+	if _, ok := store.FindFileByPath(sibling); !ok {
+		t.Errorf("%s was removed with the directory of the same name", sibling)
+	}
+}
@@ -0,0 +1,206 @@
+// This file resolves the stream map of a preset against the probe of a source
+// into explicit ffmpeg stream mappings.
+package filesystem
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// timecodeTrackCodec is the codec of the data stream holding a mov timecode
+const timecodeTrackCodec = "tmcd"
+
+// typeSpecifiers are the ffmpeg stream specifiers of each stream type
+var typeSpecifiers = map[types.StreamType]string{
+	types.VideoStream:    "v",
+	types.AudioStream:    "a",
+	types.SubtitleStream: "s",
+	types.DataStream:     "d",
+}
+
+// streamArgs maps the streams selected by the preset, the maps use type
+// relative specifiers (0:a:1) so passes can tell the stream types apart
+func streamArgs(preset types.PresetBundle, media *types.MediaInfo, trim *types.Trim, args ffmpeg.KwArgs) error {
+	streams := preset.Streams
+	if streams == nil {
+		return nil
+	}
+	if media == nil {
+		return fmt.Errorf("%w: stream mapping requires a probed source", errMissingStream)
+	}
+
+	var maps []string
+	if !preset.AudioOnly() {
+		video, err := selectStreams(media, types.VideoStream, streams.Video)
+		if err != nil {
+			return err
+		}
+		maps = append(maps, video...)
+	}
+	audio, err := selectStreams(media, types.AudioStream, streams.Audio)
+	if err != nil {
+		return err
+	}
+	maps = append(maps, audio...)
+
+	if streams.Data {
+		data := slices.DeleteFunc(streamsOfType(media, types.DataStream), func(s types.MediaStream) bool {
+			return s.Codec == timecodeTrackCodec
+		})
+		for _, stream := range data {
+			maps = append(maps, streamSpecifier(media, stream))
+		}
+		if len(data) > 0 {
+			args["c:d"] = types.CopyCodec
+		}
+	}
+	if len(maps) == 0 {
+		return fmt.Errorf("%w: preset %s selects none of the source streams", errMissingStream, preset.Name)
+	}
+	args["map"] = maps
+
+	// the timecode track is rebuilt by the muxer from the start timecode
+	if streams.Timecode && media.Timecode != "" {
+		tc := media.Timecode
+		if trim != nil {
+			if video := media.Video(); video != nil {
+				tc = offsetTimecode(tc, float64(trim.In), video.FrameRate)
+			}
+		}
+		args["timecode"] = tc
+	}
+	return nil
+}
+
+// selectStreams returns the specifiers of the streams of one type picked by a selection
+func selectStreams(media *types.MediaInfo, streamType types.StreamType, selection *types.StreamSelection) ([]string, error) {
+	mode := types.SelectFirst
+	if selection != nil && selection.Mode != "" {
+		mode = selection.Mode
+	}
+	candidates := streamsOfType(media, streamType)
+	if streamType == types.VideoStream {
+		// cover art is only kept when selected by index
+		candidates = slices.DeleteFunc(candidates, func(s types.MediaStream) bool { return s.AttachedPic && mode != types.SelectTracks })
+	}
+
+	var picked []types.MediaStream
+	switch mode {
+	case types.SelectNone:
+	case types.SelectFirst:
+		if len(candidates) > 0 {
+			picked = candidates[:1]
+		}
+	case types.SelectAll:
+		picked = candidates
+	case types.SelectTracks:
+		for _, index := range selection.Tracks {
+			i := slices.IndexFunc(candidates, func(s types.MediaStream) bool { return s.Index == index })
+			if i < 0 {
+				return nil, fmt.Errorf("%w: the source has no %s stream at index %d", errMissingStream, streamType, index)
+			}
+			picked = append(picked, candidates[i])
+		}
+	case types.SelectLanguages:
+		for _, stream := range candidates {
+			if slices.ContainsFunc(selection.Languages, func(lang string) bool { return strings.EqualFold(lang, stream.Language) }) {
+				picked = append(picked, stream)
+			}
+		}
+		if len(picked) == 0 {
+			return nil, fmt.Errorf("%w: the source has no %s stream in %s", errMissingStream, streamType, strings.Join(selection.Languages, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown selection mode %s", errMissingStream, mode)
+	}
+
+	specifiers := make([]string, len(picked))
+	for i, stream := range picked {
+		specifiers[i] = streamSpecifier(media, stream)
+	}
+	return specifiers, nil
+}
+
+func streamsOfType(media *types.MediaInfo, streamType types.StreamType) []types.MediaStream {
+	var streams []types.MediaStream
+	for _, stream := range media.Streams {
+		if stream.Type == streamType {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// streamSpecifier returns the type relative specifier of a stream, e.g. 0:a:1
+// for the second audio stream
+func streamSpecifier(media *types.MediaInfo, stream types.MediaStream) string {
+	position := 0
+	for _, s := range media.Streams {
+		if s.Index == stream.Index {
+			break
+		}
+		if s.Type == stream.Type {
+			position++
+		}
+	}
+	return fmt.Sprintf("0:%s:%d", typeSpecifiers[stream.Type], position)
+}
+
+// videoMaps keeps the video streams of a mapping, used by analysis passes
+func videoMaps(maps []string) []string {
+	return slices.DeleteFunc(slices.Clone(maps), func(spec string) bool {
+		return !strings.HasPrefix(spec, "0:v:")
+	})
+}
+
+// offsetTimecode moves a HH:MM:SS:FF timecode forward by a number of seconds,
+// timecodes that can't be parsed are returned unchanged; drop frame timecodes
+// (HH:MM:SS;FF at 29.97 or 59.94 fps) skip the frame numbers they drop
+func offsetTimecode(tc string, seconds float64, frameRate float64) string {
+	fields := strings.FieldsFunc(tc, func(r rune) bool { return r == ':' || r == ';' || r == '.' })
+	fps := int(math.Round(frameRate))
+	if len(fields) != 4 || fps <= 0 {
+		return tc
+	}
+	values := make([]int, 4)
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return tc
+		}
+		values[i] = value
+	}
+	hh, mm, ss, ff := values[0], values[1], values[2], values[3]
+
+	// drop frame skips the first frame numbers of every minute but each tenth
+	dropped := 0
+	separator := ":"
+	if strings.Contains(tc, ";") && fps%30 == 0 {
+		dropped = fps / 15
+		separator = ";"
+	}
+	minutes := hh*60 + mm
+	frames := ((hh*60+mm)*60+ss)*fps + ff - dropped*(minutes-minutes/10)
+	frames += int(math.Round(seconds * frameRate))
+
+	framesPerMinute := fps*60 - dropped
+	framesPer10Minutes := framesPerMinute*10 + dropped
+	frames %= framesPer10Minutes * 6 * 24
+	if dropped > 0 {
+		tens, rest := frames/framesPer10Minutes, frames%framesPer10Minutes
+		frames += dropped * 9 * tens
+		if rest > dropped {
+			frames += dropped * ((rest - dropped) / framesPerMinute)
+		}
+	}
+	ff = frames % fps
+	s := frames / fps
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", s/3600, s/60%60, s%60, separator, ff)
+}
@@ -0,0 +1,84 @@
+package filesystem
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	types "blockbuffer/internal/types"
+)
+
+func TestSelectStreams(t *testing.T) {
+	media := &types.MediaInfo{Streams: []types.MediaStream{
+		{Index: 0, Type: types.VideoStream, Codec: "h264"},
+		{Index: 1, Type: types.VideoStream, Codec: "mjpeg", AttachedPic: true},
+		{Index: 2, Type: types.AudioStream, Codec: "aac", Language: "eng"},
+		{Index: 3, Type: types.AudioStream, Codec: "aac", Language: "fra"},
+		{Index: 4, Type: types.AudioStream, Codec: "ac3"},
+		{Index: 5, Type: types.SubtitleStream, Codec: "subrip", Language: "eng"},
+	}}
+	tests := []struct {
+		name       string
+		streamType types.StreamType
+		selection  *types.StreamSelection
+		want       []string
+		wantErr    bool
+	}{
+		{"first by default", types.VideoStream, nil, []string{"0:v:0"}, false},
+		{"cover art is skipped", types.VideoStream, &types.StreamSelection{Mode: types.SelectAll}, []string{"0:v:0"}, false},
+		{"cover art by index", types.VideoStream, &types.StreamSelection{Mode: types.SelectTracks, Tracks: []int{1}}, []string{"0:v:1"}, false},
+		{"all", types.AudioStream, &types.StreamSelection{Mode: types.SelectAll}, []string{"0:a:0", "0:a:1", "0:a:2"}, false},
+		{"none", types.AudioStream, &types.StreamSelection{Mode: types.SelectNone}, []string{}, false},
+		{"tracks keep their order", types.AudioStream, &types.StreamSelection{Mode: types.SelectTracks, Tracks: []int{3, 2}}, []string{"0:a:1", "0:a:0"}, false},
+		{"track of another type", types.AudioStream, &types.StreamSelection{Mode: types.SelectTracks, Tracks: []int{0}}, nil, true},
+		{"languages ignore case", types.AudioStream, &types.StreamSelection{Mode: types.SelectLanguages, Languages: []string{"FRA"}}, []string{"0:a:1"}, false},
+		{"missing language", types.AudioStream, &types.StreamSelection{Mode: types.SelectLanguages, Languages: []string{"deu"}}, nil, true},
+		{"unknown mode", types.AudioStream, &types.StreamSelection{Mode: "best"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectStreams(media, tt.streamType, tt.selection)
+			if tt.wantErr {
+				if !errors.Is(err, errMissingStream) {
+					t.Errorf("got error %v, want %v", err, errMissingStream)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffsetTimecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		tc        string
+		seconds   float64
+		frameRate float64
+		want      string
+	}{
+		{"seconds", "01:00:00:00", 10, 25, "01:00:10:00"},
+		{"frames", "01:00:00:00", 1.2, 25, "01:00:01:05"},
+		{"wraps at midnight", "23:59:59:24", 0.04, 25, "00:00:00:00"},
+		{"drop frame skips frame numbers", "00:00:59;29", 1 / 29.97, 29.97, "00:01:00;02"},
+		{"drop frame keeps the tenth minute", "00:09:59;29", 1 / 29.97, 29.97, "00:10:00;00"},
+		{"drop frame counts real time", "01:00:00;00", 60, 29.97, "01:00:59;28"},
+		{"drop frame at 59.94", "00:00:00;00", 120, 59.94, "00:01:59;57"},
+		{"semicolon without drop frame rate", "10:00:00;00", 1, 25, "10:00:01:00"},
+		{"too few fields", "01:00:00", 10, 25, "01:00:00"},
+		{"not a number", "01:00:xx:00", 10, 25, "01:00:xx:00"},
+		{"unknown frame rate", "01:00:00:00", 10, 0, "01:00:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offsetTimecode(tt.tc, tt.seconds, tt.frameRate); got != tt.want {
+				t.Errorf("offsetTimecode(%q, %v, %v) = %q, want %q", tt.tc, tt.seconds, tt.frameRate, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+// This file finds the subtitle files next to sources and maps, converts, burns
+// in or extracts the subtitles selected by a preset.
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	io "blockbuffer/internal/io"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// subtitleFileCodecs maps the extensions of subtitle files picked up next to a
+// source to their codec
+var subtitleFileCodecs = map[string]string{
+	".srt": "subrip",
+	".ass": "ass",
+}
+
+// findSubtitleFiles returns the subtitle files named after a source, e.g.
+// movie.srt or movie.eng.srt next to movie.mp4
+func findSubtitleFiles(filePath string) []types.SubtitleFile {
+	dir := filepath.Dir(filePath)
+	base := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []types.SubtitleFile
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if _, ok := subtitleFileCodecs[strings.ToLower(ext)]; entry.IsDir() || !ok {
+			continue
+		}
+		stem := strings.TrimSuffix(name, ext)
+		if stem != base && !strings.HasPrefix(stem, base+".") {
+			continue
+		}
+		language := ""
+		if stem != base {
+			language = strings.ToLower(strings.TrimPrefix(stem, base+"."))
+		}
+		files = append(files, types.SubtitleFile{Path: filepath.Join(dir, name), Language: language})
+	}
+	return files
+}
+
+// subtitleTrack is a subtitle stream of the source or a subtitle file next to it
+type subtitleTrack struct {
+	input    int    // ffmpeg input holding the track, 0 for the source
+	position int    // position among the subtitle streams of the input
+	path     string // subtitle file, empty for streams of the source
+	codec    string
+	language string
+}
+
+func (t subtitleTrack) specifier() string {
+	return fmt.Sprintf("%d:s:%d", t.input, t.position)
+}
+
+// selectSubtitles returns the subtitle tracks picked by a preset, the streams of
+// the source come before the subtitle files next to it
+func selectSubtitles(file types.File, subtitles *types.SubtitlePreset) ([]subtitleTrack, error) {
+	var candidates []subtitleTrack
+	indices := map[int]int{} // probe index of each source stream to its candidate
+	if file.Media != nil {
+		for position, stream := range streamsOfType(file.Media, types.SubtitleStream) {
+			indices[stream.Index] = len(candidates)
+			candidates = append(candidates, subtitleTrack{position: position, codec: stream.Codec, language: stream.Language})
+		}
+	}
+	for _, sub := range file.Subtitles {
+		codec := subtitleFileCodecs[strings.ToLower(filepath.Ext(sub.Path))]
+		candidates = append(candidates, subtitleTrack{path: sub.Path, codec: codec, language: sub.Language})
+	}
+
+	mode := types.SelectAll
+	if subtitles.Mode == types.SubtitleBurn {
+		mode = types.SelectFirst
+	}
+	selection := subtitles.Select
+	if selection != nil && selection.Mode != "" {
+		mode = selection.Mode
+	}
+
+	var picked []subtitleTrack
+	switch mode {
+	case types.SelectNone:
+	case types.SelectFirst:
+		if len(candidates) > 0 {
+			picked = candidates[:1]
+		}
+	case types.SelectAll:
+		picked = candidates
+	case types.SelectTracks:
+		// subtitle files have no probe index, only source streams can be picked
+		for _, index := range selection.Tracks {
+			i, ok := indices[index]
+			if !ok {
+				return nil, fmt.Errorf("%w: the source has no subtitle stream at index %d", errMissingStream, index)
+			}
+			picked = append(picked, candidates[i])
+		}
+	case types.SelectLanguages:
+		for _, track := range candidates {
+			if slices.ContainsFunc(selection.Languages, func(lang string) bool { return strings.EqualFold(lang, track.language) }) {
+				picked = append(picked, track)
+			}
+		}
+		if len(picked) == 0 {
+			return nil, fmt.Errorf("%w: the source has no subtitles in %s", errMissingStream, strings.Join(selection.Languages, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown selection mode %s", errMissingStream, mode)
+	}
+	if subtitles.Mode == types.SubtitleBurn && len(picked) > 1 {
+		picked = picked[:1]
+	}
+	return slices.Clone(picked), nil
+}
+
+// subtitleArgs maps, converts or burns in the subtitles selected by the preset
+// and returns the subtitle files to add as inputs, burn-in must follow the
+// scale filter so subtitles are rendered at the output size
+func subtitleArgs(preset types.PresetBundle, file types.File, trim *types.Trim, args ffmpeg.KwArgs) ([]string, error) {
+	subtitles := preset.Subtitles
+	if subtitles == nil || subtitles.Mode == types.SubtitleSidecar {
+		return nil, nil
+	}
+	if subtitles.Mode == types.SubtitleNone {
+		args["sn"] = ""
+		return nil, nil
+	}
+	tracks, err := selectSubtitles(file, subtitles)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtitles.Mode == types.SubtitleBurn {
+		// burned in subtitles aren't also written as a stream
+		args["sn"] = ""
+		if len(tracks) == 0 {
+			return nil, nil
+		}
+		if types.IsBitmapSubtitle(tracks[0].codec) {
+			return nil, fmt.Errorf("%w: %s subtitles are images and can't be burned in", errMissingStream, tracks[0].codec)
+		}
+		filter := burnFilter(file.FilePath, tracks[0], trim)
+		if vf, ok := args["vf"].(string); ok && vf != "" {
+			filter = vf + "," + filter
+		}
+		args["vf"] = filter
+		return nil, nil
+	}
+
+	if len(tracks) == 0 {
+		return nil, nil
+	}
+	// subtitles are only written when mapped, so the other streams are mapped too
+	maps, ok := args["map"].([]string)
+	if !ok {
+		if file.Media == nil {
+			return nil, fmt.Errorf("%w: subtitles require a probed source", errMissingStream)
+		}
+		if !preset.AudioOnly() {
+			video, _ := selectStreams(file.Media, types.VideoStream, nil)
+			maps = append(maps, video...)
+		}
+		audio, _ := selectStreams(file.Media, types.AudioStream, nil)
+		maps = append(maps, audio...)
+	}
+
+	var inputs []string
+	codec := types.CopyCodec
+	if subtitles.Mode == types.SubtitleConvert {
+		codec = subtitles.Codec
+	}
+	for _, track := range tracks {
+		if codec != types.CopyCodec && types.IsBitmapSubtitle(track.codec) != types.IsBitmapSubtitle(codec) {
+			return nil, fmt.Errorf("%w: %s subtitles can't be converted to %s", errMissingStream, track.codec, codec)
+		}
+		if track.path != "" {
+			inputs = append(inputs, track.path)
+			track.input = len(inputs)
+		}
+		maps = append(maps, track.specifier())
+	}
+	args["map"] = maps
+	args["c:s"] = codec
+	return inputs, nil
+}
+
+// burnFilter renders a subtitle track with the subtitles filter, trimmed jobs
+// shift the frames back to source time while the subtitles are drawn
+func burnFilter(source string, track subtitleTrack, trim *types.Trim) string {
+	filter := "subtitles=filename=" + escapeFilterValue(source) + fmt.Sprintf(":si=%d", track.position)
+	if track.path != "" {
+		filter = "subtitles=filename=" + escapeFilterValue(track.path)
+	}
+	if trim == nil || trim.In == 0 {
+		return filter
+	}
+	return fmt.Sprintf("setpts=PTS+%.3f/TB,%s,setpts=PTS-STARTPTS", float64(trim.In), filter)
+}
+
+var (
+	filterOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filterGraphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// escapeFilterValue escapes a filter option value, e.g. a path, for both the
+// option and the filtergraph levels of ffmpeg filter parsing
+func escapeFilterValue(value string) string {
+	return filterGraphEscaper.Replace(filterOptionEscaper.Replace(value))
+}
+
+// subtitleSidecarPaths names the subtitle files written next to an output
+// after the output and the language of each track, e.g. movie.eng.srt
+func subtitleSidecarPaths(outFile string, tracks []subtitleTrack, ext string) []string {
+	base := strings.TrimSuffix(outFile, filepath.Ext(outFile))
+	paths := make([]string, len(tracks))
+	for i, track := range tracks {
+		name := base
+		if track.language != "" {
+			name += "." + track.language
+		}
+		paths[i] = name + "." + ext
+		for n := 2; slices.Contains(paths[:i], paths[i]); n++ {
+			paths[i] = fmt.Sprintf("%s.%d.%s", name, n, ext)
+		}
+	}
+	return paths
+}
+
+// writeSubtitleSidecars extracts the selected subtitle tracks of a converted
+// output into files next to it and records them on the output
+func writeSubtitleSidecars(inputFile types.File, i int, output types.Output, preset types.PresetBundle) error {
+	subtitles := preset.Subtitles
+	tracks, err := selectSubtitles(inputFile, subtitles)
+	if err != nil || len(tracks) == 0 {
+		return err
+	}
+	paths := subtitleSidecarPaths(output.FilePath, tracks, types.SubtitleExtensions[subtitles.Codec])
+
+	for n, track := range tracks {
+		if types.IsBitmapSubtitle(track.codec) {
+			removeFiles(paths[:n])
+			return fmt.Errorf("%w: %s subtitles can't be converted to %s", errMissingStream, track.codec, subtitles.Codec)
+		}
+		args := ffmpeg.KwArgs{"map": []string{track.specifier()}, "c:s": subtitles.Codec}
+		job := TranscodeJob{
+			FileID:    inputFile.ID,
+			Output:    i,
+			InFile:    inputFile.FilePath,
+			OutFile:   paths[n],
+			InputArgs: trimArgs(inputFile, args),
+			Args:      args,
+			Duration:  inputFile.Duration,
+		}
+		if track.path != "" {
+			job.InFile = track.path
+		}
+		io.Logf("Writing subtitles of %s: %s", io.Info, inputFile.FilePath, paths[n])
+		if err := Backend.Run(job, func(progress float32) {}); err != nil {
+			removeFiles(paths[:n+1])
+			return err
+		}
+	}
+
+	file, ok := store.ModifyFile(inputFile.ID, func(file *types.File) {
+		if i >= len(file.Outputs) {
+			return
+		}
+		file.Outputs = append([]types.Output{}, file.Outputs...)
+		file.Outputs[i].Subtitles = paths
+	})
+	if ok {
+		broadcastFile(file, false)
+	}
+	return nil
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
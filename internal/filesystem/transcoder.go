@@ -0,0 +1,77 @@
+// This file defines the backend used to probe and encode files so the queue
+// doesn't depend on how ffmpeg is run.
+package filesystem
+
+import (
+	"fmt"
+
+	types "blockbuffer/internal/types"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// TranscodeJob describes the encode of a single output
+type TranscodeJob struct {
+	FileID    string
+	Output    int // index of the output in the file
+	InFile    string
+	OutFile   string
+	InputArgs ffmpeg.KwArgs // options applied to the input, e.g. the seek of a trimmed job
+	Subtitles []string      // subtitle files added as inputs 1 onwards, sharing the input options
+	Args      ffmpeg.KwArgs
+	Duration  float64 // seconds converted, used to compute progress
+}
+
+// SnapshotJob describes the render of a single image from a source
+type SnapshotJob struct {
+	InFile    string
+	OutFile   string
+	InputArgs ffmpeg.KwArgs // e.g. the seek to the poster frame
+	Filter    string        // video filter producing the image
+}
+
+// CropJob describes a crop detection run over a section of a source
+type CropJob struct {
+	InFile    string
+	InputArgs ffmpeg.KwArgs // e.g. the seek to the section
+	Duration  float64       // seconds analysed
+}
+
+// ProgressFunc receives the progress of a running job as a percentage
+type ProgressFunc func(progress float32)
+
+// Transcoder probes and encodes files, a file has at most one running job
+type Transcoder interface {
+	// Probe returns the media info of a file
+	Probe(filePath string) (*types.MediaInfo, error)
+	// Run encodes a job, blocking until it ends; progress is reported below 100,
+	// completion is reported by a nil error
+	Run(job TranscodeJob, progress ProgressFunc) error
+	// Cancel stops the running job of a file and removes its partial output
+	Cancel(fileId string)
+	// Pause suspends the running job of a file
+	Pause(fileId string) error
+	// Resume continues a paused job
+	Resume(fileId string) error
+	// Snapshot renders one image from a source, blocking until it is written
+	Snapshot(job SnapshotJob) error
+	// DetectCrop returns the smallest rectangle holding the picture of a
+	// section, leaving out black bars
+	DetectCrop(job CropJob) (types.CropRect, error)
+}
+
+// Backend is the transcoder used by the queue
+var Backend Transcoder = NewFFmpegTranscoder()
+
+// UseTranscoder selects the backend by name: ffmpeg or fake
+func UseTranscoder(name string) error {
+	switch name {
+	case "", "ffmpeg":
+		Backend = NewFFmpegTranscoder()
+	case "fake":
+		Backend = NewFakeTranscoder()
+	default:
+		return fmt.Errorf("unknown transcoder %s, expected ffmpeg or fake", name)
+	}
+	return nil
+}
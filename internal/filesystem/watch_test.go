@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	api "blockbuffer/internal/api"
+	store "blockbuffer/internal/store"
+	types "blockbuffer/internal/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// socketMessage is a broadcast as a client receives it
+type socketMessage struct {
+	MessageType types.MessageType `json:"type"`
+	Data        json.RawMessage   `json:"data"`
+}
+
+// watchFolder adds a hot folder with its own directories and starts watching it
+func watchFolder(t *testing.T, name string, presets []string) types.HotFolder {
+	t.Helper()
+	dir := t.TempDir()
+	folder := types.HotFolder{
+		Name:      name,
+		WatchDir:  filepath.Join(dir, "input"),
+		OutputDir: filepath.Join(dir, "output"),
+		Presets:   presets,
+	}
+	if err := os.MkdirAll(folder.WatchDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	types.HotFoldersMutex.Lock()
+	types.HotFolders = append(types.HotFolders, folder)
+	types.HotFoldersMutex.Unlock()
+	t.Cleanup(func() {
+		types.HotFoldersMutex.Lock()
+		types.HotFolders = slices.DeleteFunc(types.HotFolders, func(f types.HotFolder) bool { return f.Name == name })
+		types.HotFoldersMutex.Unlock()
+	})
+	go WatchDirectory(folder)
+	return folder
+}
+
+// dropSource writes a source file into a watched directory, the file is
+// written again until the watcher, which starts asynchronously, picks it up
+func dropSource(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		if err := os.WriteFile(path, []byte("source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for range 50 {
+			if _, ok := store.FindFileByPath(path); ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		os.Remove(path)
+	}
+	t.Fatalf("%s was not picked up by the watcher", path)
+}
+
+// subscribe connects a websocket client and returns the messages it receives
+func subscribe(t *testing.T) <-chan socketMessage {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(api.HandleSocketConnections))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		conn.Close()
+		server.Close()
+	})
+
+	messages := make(chan socketMessage, 256)
+	go func() {
+		for {
+			var message socketMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// the snapshot sent on connect shows the client is registered for broadcasts
+	if message := <-messages; message.MessageType != types.RefreshFiles {
+		t.Fatalf("first message is %s, want %s", message.MessageType, types.RefreshFiles)
+	}
+	return messages
+}
+
+// waitForMessage reads broadcasts until one of the given type carries a file matching the condition
+func waitForMessage(t *testing.T, messages <-chan socketMessage, messageType types.MessageType, cond func(types.File) bool) types.File {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case message := <-messages:
+			if message.MessageType != messageType {
+				continue
+			}
+			var files map[string]types.File
+			if err := json.Unmarshal(message.Data, &files); err != nil {
+				t.Fatalf("%s message: %v", messageType, err)
+			}
+			for _, file := range files {
+				if cond(file) {
+					return file
+				}
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a %s message", messageType)
+		}
+	}
+}
+
+func TestWatchQueueConvertBroadcast(t *testing.T) {
+	folder := watchFolder(t, "watched", []string{"MP4"})
+	messages := subscribe(t)
+
+	source := filepath.Join(folder.WatchDir, "watched.mp4")
+	dropSource(t, source)
+
+	created := waitForMessage(t, messages, types.CreateFile, func(file types.File) bool { return file.FilePath == source })
+	if created.HotFolder != folder.Name || created.Status != types.Queued || len(created.Outputs) != 1 {
+		t.Fatalf("created %s job in %q with %d outputs, want a queued job in %q with 1 output",
+			created.Status, created.HotFolder, len(created.Outputs), folder.Name)
+	}
+	if created.Media == nil {
+		t.Error("the source was not probed when it was detected")
+	}
+
+	// progress updates are throttled, only the final state is always sent
+	completed := waitForMessage(t, messages, types.UpdateFile, func(file types.File) bool {
+		return file.ID == created.ID && file.Status == types.Completed
+	})
+	output := completed.Outputs[0]
+	if want := filepath.Join(folder.OutputDir, "watched_mp4.mp4"); output.FilePath != want || output.Progress != 100 {
+		t.Errorf("completed output %s at %v%%, want %s at 100%%", output.FilePath, output.Progress, want)
+	}
+	if _, err := os.Stat(output.FilePath); err != nil {
+		t.Errorf("output was not written: %v", err)
+	}
+
+	// removing the source drops the job and tells the clients
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, messages, types.DeleteFile, func(file types.File) bool { return file.ID == created.ID })
+	if _, ok := store.GetFile(created.ID); ok {
+		t.Error("the job of the removed source is still tracked")
+	}
+}
@@ -34,3 +34,11 @@ func ErrorJSON(w http.ResponseWriter, message string, code int) {
 	jsonData := json.NewEncoder(w)
 	jsonData.Encode(map[string]interface{}{"error": message, "code": code})
 }
+
+// FieldErrorJSON sends a 422 response listing the request fields that failed validation
+func FieldErrorJSON(w http.ResponseWriter, message string, fields map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	jsonData := json.NewEncoder(w)
+	jsonData.Encode(map[string]interface{}{"error": message, "code": http.StatusUnprocessableEntity, "fields": fields})
+}
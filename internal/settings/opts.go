@@ -21,6 +21,7 @@ var Headless *bool
 var WatchDir *string  // WatchDir is the directory to watch for new files
 var OutputDir *string // OutputDir is the directory to output converted files
 var UploadDir *string // UploadDir is the directory to store files being uploaded by the user
+var DataDir *string   // DataDir is the directory to store job data that survives restarts
 var LogLevel *string  // LogLevel is the log level to use
 
 /**
@@ -31,15 +32,23 @@ var MaxConcurrent *int       // max number of concurrent conversions
 var AutoConvert *bool        // true to automatically convert files in the watch directory
 var DeleteAfter *bool        // true to delete source files after conversion
 var OverwriteExisting *bool  // true to overwrite already converted files
+var Recursive *bool          // true to scan and watch subdirectories of the watch directory
+var MirrorOutput *bool       // true to recreate the source directory structure in the output directory
 var PresetConfigPath *string // path to the preset configuration file
+var Transcoder *string       // backend used to probe and convert files: ffmpeg or fake
+var ContactSheet *int        // number of frames in the contact sheet of each source, 0 to skip it
+var PreviewLength *int       // default length in seconds of preview encodes
 
 /**
 *  FILE QUEUE OPTIONS
  **/
 var MaxQueueSize *int
+var Schedule *string  // Schedule is the policy used to pick the next job: fifo, shortest or round-robin
+var MaxRetries *int   // MaxRetries is the number of times a transient failure is retried
+var RetryBackoff *int // RetryBackoff is the delay in seconds before the first retry, doubled for each attempt
 
-const maxCheckInterval = 5 * time.Second
-const maxCheckRepeat = 30 // 5 minutes, to support larger files or slow writes
+const MaxCheckInterval = 5 * time.Second
+const MaxCheckRepeat = 30 // 5 minutes, to support larger files or slow writes
 const maxQueueRetry = 3   // failed files will be retried up to 3 times
 
 func init() {
@@ -51,13 +60,22 @@ func init() {
 
 	MaxConcurrent = opts.Int("concurrency", 1, opts.Description("Max number of concurrent conversions"), opts.Alias("c"))
 	MaxQueueSize = opts.Int("queue-size", 100, opts.Description("Max number of files to queue"), opts.Alias("q"))
+	Schedule = opts.String("schedule", "fifo", opts.Description("Order queued files are converted in: fifo, shortest or round-robin"), opts.Alias("s"))
+	MaxRetries = opts.Int("max-retries", maxQueueRetry, opts.Description("Max number of retries for transient conversion failures"), opts.Alias("r"))
+	RetryBackoff = opts.Int("retry-backoff", 30, opts.Description("Seconds to wait before retrying a failed conversion, doubled for each attempt"), opts.Alias("b"))
 	WatchDir = opts.String("watch-dir", "./media/input", opts.Description("Directory to watch for new files"), opts.Alias("w"))
 	OutputDir = opts.String("output-dir", "./media/output", opts.Description("Directory to output converted files"), opts.Alias("o"))
 	UploadDir = opts.String("upload-dir", "./media/upload", opts.Description("Directory to store files being uploaded by the user"), opts.Alias("u"))
+	DataDir = opts.String("data-dir", "./media/data", opts.Description("Directory to store job data that survives restarts"), opts.Alias("D"))
 
 	AutoConvert = opts.Bool("auto-convert", true, opts.Description("Automatically convert files in the watch directory"), opts.Alias("a"))
 	DeleteAfter = opts.Bool("delete-after", false, opts.Description("Delete source files after conversion"), opts.Alias("d"))
 	OverwriteExisting = opts.Bool("overwrite-existing", false, opts.Description("Overwrite already converted files"), opts.Alias("O"))
+	Recursive = opts.Bool("recursive", false, opts.Description("Scan and watch subdirectories of the watch directory"), opts.Alias("R"))
+	MirrorOutput = opts.Bool("mirror-output", false, opts.Description("Recreate the source directory structure in the output directory"), opts.Alias("m"))
+	Transcoder = opts.String("transcoder", "ffmpeg", opts.Description("Backend used to convert files: ffmpeg, or fake to run the pipeline without ffmpeg"), opts.Alias("t"))
+	ContactSheet = opts.Int("contact-sheet", 12, opts.Description("Number of frames in the contact sheet generated for each source, 0 to only extract a thumbnail"), opts.Alias("C"))
+	PreviewLength = opts.Int("preview-length", 5, opts.Description("Default length in seconds of preview encodes"), opts.Alias("S"))
 	PresetConfigPath = opts.String("preset-config", "./presets.json", opts.Description("Path to the preset configuration file"), opts.Alias("P"))
 	// evaluate full path for preset config
 	var fullpath, err = filepath.Abs(*PresetConfigPath)
@@ -2,18 +2,92 @@ package store
 
 import (
 	"sync"
+	"time"
 
-	opts "blockbuffer/internal/settings"
 	types "blockbuffer/internal/types"
 )
 
 var FileListMutex = &sync.Mutex{}
 var FileList = make(map[string]types.File) // FileList is a map of file ID to file
-// var FileQueue chan types.File              // fileQueue is a channel to queue files to be processed
-var FileQueue = make(chan types.File, *opts.MaxQueueSize)
 
 func UpdateFile(file types.File) {
 	FileListMutex.Lock()
+	prev, existed := FileList[file.ID]
+	statusChanged := !existed || prev.Status != file.Status
+	if statusChanged {
+		recordTransition(&file)
+	}
 	FileList[file.ID] = file
 	FileListMutex.Unlock()
+	markDirty()
+}
+
+// ModifyFile applies a change to a tracked file and returns the updated file,
+// false if the file is not tracked
+func ModifyFile(fileId string, modify func(file *types.File)) (types.File, bool) {
+	FileListMutex.Lock()
+	file, ok := FileList[fileId]
+	if !ok {
+		FileListMutex.Unlock()
+		return file, false
+	}
+
+	prevStatus := file.Status
+	modify(&file)
+	if file.Status != prevStatus {
+		recordTransition(&file)
+	}
+	FileList[fileId] = file
+	FileListMutex.Unlock()
+	markDirty()
+	return file, true
+}
+
+// GetFile returns the tracked file with the given ID
+func GetFile(fileId string) (types.File, bool) {
+	FileListMutex.Lock()
+	defer FileListMutex.Unlock()
+	file, ok := FileList[fileId]
+	return file, ok
+}
+
+// FindFileByPath returns the tracked file with the given source path
+func FindFileByPath(filePath string) (types.File, bool) {
+	FileListMutex.Lock()
+	defer FileListMutex.Unlock()
+	for _, file := range FileList {
+		if file.FilePath == filePath {
+			return file, true
+		}
+	}
+	return types.File{}, false
+}
+
+// Files returns a copy of the file list that is safe to iterate
+func Files() map[string]types.File {
+	FileListMutex.Lock()
+	defer FileListMutex.Unlock()
+	files := make(map[string]types.File, len(FileList))
+	for id, file := range FileList {
+		files[id] = file
+	}
+	return files
+}
+
+// RemoveFile stops tracking a file
+func RemoveFile(fileId string) {
+	FileListMutex.Lock()
+	delete(FileList, fileId)
+	FileListMutex.Unlock()
+	Dequeue(fileId)
+	BindPreset(fileId, "")
+	removePreviews(fileId)
+	markDirty()
+}
+
+// recordTransition appends the current status to the file history
+func recordTransition(file *types.File) {
+	history := make([]types.StatusChange, len(file.History), len(file.History)+1)
+	copy(history, file.History)
+	file.History = append(history, types.StatusChange{Status: file.Status, Time: time.Now()})
 }
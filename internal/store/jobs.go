@@ -0,0 +1,186 @@
+// This file persists the file list, preset bindings and queue order to disk
+// so that jobs survive restarts of the server.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+)
+
+// jobStoreVersion is the format written by SaveJobs, version 1 stores have
+// no queue order
+const jobStoreVersion = 2
+const jobStoreFile = "jobs.json"
+const persistInterval = 1 * time.Second // progress updates within this window are saved together
+
+// errUnknownVersion is returned when the job store was written by a newer release
+var errUnknownVersion = errors.New("unsupported job store version")
+
+type jobStore struct {
+	Version        int               `json:"version"`
+	Jobs           []types.File      `json:"jobs"`
+	PresetBindings map[string]string `json:"presetBindings"`
+	GlobalBinding  string            `json:"globalBinding"`
+	Queue          []string          `json:"queue"` // IDs of the waiting jobs in queue order
+}
+
+var saveSignal = make(chan bool, 1)
+var saveMutex = &sync.Mutex{}    // serializes writes of the job store
+var restoredOrder map[string]int // queue position of the jobs waiting when the store was saved
+
+// markDirty schedules the job store to be saved
+func markDirty() {
+	select {
+	case saveSignal <- true:
+	default:
+	}
+}
+
+func jobStorePath() string {
+	return filepath.Join(*opts.DataDir, jobStoreFile)
+}
+
+// LoadJobs restores the file list, preset bindings and queue order saved by a
+// previous run. A store written by a newer release is moved aside instead of
+// being overwritten by the next save
+func LoadJobs() error {
+	data, err := os.ReadFile(jobStorePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved jobStore
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if saved.Version < 1 || saved.Version > jobStoreVersion {
+		kept := fmt.Sprintf("%s.v%d", jobStorePath(), saved.Version)
+		if err := os.Rename(jobStorePath(), kept); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w %d, kept as %s", errUnknownVersion, saved.Version, kept)
+	}
+
+	FileListMutex.Lock()
+	for _, file := range saved.Jobs {
+		FileList[file.ID] = file
+	}
+	FileListMutex.Unlock()
+
+	PresetBindingsMutex.Lock()
+	for fileId, name := range saved.PresetBindings {
+		PresetBindings[fileId] = name
+	}
+	GlobalBinding = saved.GlobalBinding
+	PresetBindingsMutex.Unlock()
+
+	restoredOrder = make(map[string]int, len(saved.Queue))
+	for i, fileId := range saved.Queue {
+		restoredOrder[fileId] = i
+	}
+
+	io.Logf("Restored %d jobs from %s", io.Info, len(saved.Jobs), jobStorePath())
+	return nil
+}
+
+// SaveJobs writes the job store to disk, replacing the previous copy atomically
+func SaveJobs() error {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	saved := jobStore{Version: jobStoreVersion, PresetBindings: map[string]string{}, Queue: waitingOrder()}
+	for _, file := range Files() {
+		saved.Jobs = append(saved.Jobs, file)
+	}
+	sort.Slice(saved.Jobs, func(i, j int) bool { return saved.Jobs[i].ID < saved.Jobs[j].ID })
+
+	PresetBindingsMutex.Lock()
+	for fileId, name := range PresetBindings {
+		saved.PresetBindings[fileId] = name
+	}
+	saved.GlobalBinding = GlobalBinding
+	PresetBindingsMutex.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := jobStorePath() + ".tmp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, jobStorePath())
+}
+
+// PersistJobs saves the job store whenever it changes
+func PersistJobs() {
+	for range saveSignal {
+		if err := SaveJobs(); err != nil {
+			io.Logf("Error saving job store: %v", io.Error, err)
+		}
+		time.Sleep(persistInterval)
+	}
+}
+
+// RestoredQueue returns the jobs that were queued, processing or paused when the
+// store was saved. Jobs that were converting come first, followed by the waiting
+// jobs in their saved queue order; stores without an order use the queueing time
+func RestoredQueue() []types.File {
+	var queue []types.File
+	for _, file := range Files() {
+		switch file.Status {
+		case types.Queued, types.Processing, types.Paused:
+			queue = append(queue, file)
+		}
+	}
+
+	position := func(file types.File) int {
+		if i, ok := restoredOrder[file.ID]; ok {
+			return i
+		}
+		return -1
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if a, b := position(queue[i]), position(queue[j]); a != b {
+			return a < b
+		}
+		return lastQueued(queue[i]).Before(lastQueued(queue[j]))
+	})
+	return queue
+}
+
+// lastQueued returns when the file last entered the queue
+func lastQueued(file types.File) time.Time {
+	for i := len(file.History) - 1; i >= 0; i-- {
+		if file.History[i].Status == types.Queued {
+			return file.History[i].Time
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+)
+
+// useDataDir points the job store at an empty directory and forgets the
+// tracked jobs when the test ends
+func useDataDir(t *testing.T) {
+	t.Helper()
+	prev := *opts.DataDir
+	*opts.DataDir = t.TempDir()
+	t.Cleanup(func() {
+		*opts.DataDir = prev
+		forgetJobs()
+	})
+}
+
+// forgetJobs clears what LoadJobs restores, as if the server had restarted
+func forgetJobs() {
+	FileListMutex.Lock()
+	FileList = make(map[string]types.File)
+	FileListMutex.Unlock()
+	PresetBindingsMutex.Lock()
+	PresetBindings, GlobalBinding = make(map[string]string), ""
+	PresetBindingsMutex.Unlock()
+	queueMutex.Lock()
+	waiting, pending, nextOrder = nil, map[string]bool{}, 0
+	queueMutex.Unlock()
+	restoredOrder = nil
+}
+
+func restoredIDs() []string {
+	var ids []string
+	for _, file := range RestoredQueue() {
+		ids = append(ids, file.ID)
+	}
+	return ids
+}
+
+func TestJobStoreRoundTrip(t *testing.T) {
+	useDataDir(t)
+	queueJobs(t, types.ScheduleFIFO, types.File{ID: "a", FilePath: "/in/a.mp4"}, types.File{ID: "b"}, types.File{ID: "c"})
+	UpdateFile(types.File{ID: "running", Status: types.Processing, Outputs: []types.Output{{Preset: "MP4", Status: types.Processing, Progress: 40}}})
+	UpdateFile(types.File{ID: "done", Status: types.Completed})
+	BindPreset("a", "MP4")
+	SetGlobalBinding("WAV")
+	if err := MoveJob("c", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveJobs(); err != nil {
+		t.Fatal(err)
+	}
+	before := Files()
+
+	forgetJobs()
+	if err := LoadJobs(); err != nil {
+		t.Fatal(err)
+	}
+
+	after := Files()
+	if len(after) != len(before) {
+		t.Fatalf("restored %d jobs, want %d", len(after), len(before))
+	}
+	for id, file := range before {
+		restored := after[id]
+		if restored.Status != file.Status || restored.FilePath != file.FilePath || len(restored.History) != len(file.History) {
+			t.Errorf("job %s restored as %+v, want %+v", id, restored, file)
+		}
+	}
+	if output := after["running"].Outputs[0]; output.Preset != "MP4" || output.Progress != 40 {
+		t.Errorf("restored output %+v, want the MP4 output at 40%%", output)
+	}
+	if PresetBindings["a"] != "MP4" || GlobalBinding != "WAV" {
+		t.Errorf("restored bindings %v and %q, want a bound to MP4 and WAV for the rest", PresetBindings, GlobalBinding)
+	}
+	// the converting job restarts first, the waiting jobs keep their manual order
+	if got, want := restoredIDs(), []string{"running", "c", "a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("restored queue %v, want %v", got, want)
+	}
+}
+
+func TestLoadJobsWithoutQueueOrder(t *testing.T) {
+	useDataDir(t)
+	queued := func(id string, at time.Time) types.File {
+		return types.File{ID: id, Status: types.Queued, History: []types.StatusChange{{Status: types.Queued, Time: at}}}
+	}
+	now := time.Now()
+	data, err := json.Marshal(jobStore{Version: 1, Jobs: []types.File{queued("late", now), queued("early", now.Add(-time.Minute))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*opts.DataDir, jobStoreFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restoredIDs(), []string{"early", "late"}; !slices.Equal(got, want) {
+		t.Errorf("restored queue %v, want %v", got, want)
+	}
+}
+
+func TestLoadJobsRejectsUnknownVersion(t *testing.T) {
+	useDataDir(t)
+	path := filepath.Join(*opts.DataDir, jobStoreFile)
+	data := []byte(`{"version": 99, "jobs": [{"id": "future", "status": "queued"}]}`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadJobs(); !errors.Is(err, errUnknownVersion) {
+		t.Fatalf("got error %v, want %v", err, errUnknownVersion)
+	}
+	if _, ok := GetFile("future"); ok {
+		t.Error("jobs of an unknown version were restored")
+	}
+	// the store is kept for the release that wrote it instead of being overwritten
+	if kept, err := os.ReadFile(path + ".v99"); err != nil || string(kept) != string(data) {
+		t.Errorf("store was not kept: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("store is still in place: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"sync"
+)
+
+var PresetBindingsMutex = &sync.Mutex{}
+var PresetBindings = make(map[string]string) // PresetBindings is a map of file ID to preset name
+var GlobalBinding string                     // GlobalBinding is the preset name used when a file has no binding
+
+// BindPreset assigns a preset to a file, an empty name removes the binding
+func BindPreset(fileId string, presetName string) {
+	PresetBindingsMutex.Lock()
+	defer PresetBindingsMutex.Unlock()
+	if presetName == "" {
+		delete(PresetBindings, fileId)
+	} else {
+		PresetBindings[fileId] = presetName
+	}
+	markDirty()
+}
+
+// SetGlobalBinding assigns the preset used by files without a binding
+func SetGlobalBinding(presetName string) {
+	PresetBindingsMutex.Lock()
+	GlobalBinding = presetName
+	PresetBindingsMutex.Unlock()
+	markDirty()
+}
+
+// GetGlobalBinding returns the preset used by files without a binding
+func GetGlobalBinding() string {
+	PresetBindingsMutex.Lock()
+	defer PresetBindingsMutex.Unlock()
+	return GlobalBinding
+}
+
+// PresetBinding returns the preset name bound to a file, if any
+func PresetBinding(fileId string) (string, bool) {
+	PresetBindingsMutex.Lock()
+	defer PresetBindingsMutex.Unlock()
+	name, ok := PresetBindings[fileId]
+	return name, ok
+}
+
+// UnbindPreset removes every binding to a preset, including the global binding
+func UnbindPreset(presetName string) {
+	PresetBindingsMutex.Lock()
+	defer PresetBindingsMutex.Unlock()
+	for fileId, name := range PresetBindings {
+		if name == presetName {
+			delete(PresetBindings, fileId)
+		}
+	}
+	if GlobalBinding == presetName {
+		GlobalBinding = ""
+	}
+	markDirty()
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+
+	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+)
+
+const previewDir = "previews"
+
+// ThumbnailPath returns where the poster frame of a file is stored
+func ThumbnailPath(fileId string) string {
+	return filepath.Join(*opts.DataDir, previewDir, fileId+".jpg")
+}
+
+// ContactSheetPath returns where the contact sheet of a file is stored
+func ContactSheetPath(fileId string) string {
+	return filepath.Join(*opts.DataDir, previewDir, fileId+"-sheet.jpg")
+}
+
+// removePreviews deletes the images extracted for a file
+func removePreviews(fileId string) {
+	for _, path := range []string{ThumbnailPath(fileId), ContactSheetPath(fileId)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			io.Logf("Error deleting preview %s: %v", io.Error, path, err)
+		}
+	}
+}
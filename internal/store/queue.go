@@ -0,0 +1,314 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+)
+
+const ineligibleRecheck = 2 * time.Second // how often held back jobs are checked again
+
+var queueMutex = &sync.Mutex{}
+var queueChanged = sync.NewCond(queueMutex)
+var pending = make(map[string]bool) // pending is the set of file IDs queued or converting
+var waiting []queuedJob             // waiting holds the jobs not yet picked by the scheduler
+var nextOrder int                   // order given to the next queued job
+var policy = types.ScheduleFIFO
+var lastFolder string // hot folder of the last job picked, used for round-robin
+
+// queuedJob is a file waiting in the queue, order is the manual or queueing order
+type queuedJob struct {
+	fileId string
+	order  int
+}
+
+// Enqueue adds a file to the queue, false if the file is already queued or
+// converting. Blocks while the queue is full
+func Enqueue(file types.File) bool {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	if pending[file.ID] {
+		return false
+	}
+	pending[file.ID] = true
+
+	for len(waiting) >= *opts.MaxQueueSize {
+		queueChanged.Wait()
+	}
+	pushJob(file.ID)
+	return true
+}
+
+// ReturnJob puts a job taken from the queue back at the end of it, e.g. when
+// the source file isn't ready to be converted yet
+func ReturnJob(file types.File) {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	pending[file.ID] = true
+	pushJob(file.ID)
+}
+
+func pushJob(fileId string) {
+	waiting = append(waiting, queuedJob{fileId: fileId, order: nextOrder})
+	nextOrder++
+	queueChanged.Broadcast()
+}
+
+// NextJob blocks until a job that can be converted is queued and removes it
+// from the queue, jobs rejected by eligible stay queued
+func NextJob(eligible func(file types.File) bool) types.File {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	file := waitForJob(eligible)
+	removeJob(file.ID)
+	lastFolder = file.HotFolder
+	queueChanged.Broadcast()
+	return file
+}
+
+// WaitForJob blocks until a job that can be converted is queued, leaving it
+// in the queue
+func WaitForJob(eligible func(file types.File) bool) {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	waitForJob(eligible)
+}
+
+// waitForJob returns the first eligible job in queue order once there is one,
+// the caller holds the queue lock
+func waitForJob(eligible func(file types.File) bool) types.File {
+	for {
+		held := false
+		for _, job := range orderedJobs() {
+			file, ok := GetFile(job.fileId)
+			if !ok {
+				// the file stopped being tracked while queued
+				removeJob(job.fileId)
+				delete(pending, job.fileId)
+				continue
+			}
+			if !eligible(file) {
+				held = true
+				continue
+			}
+			return file
+		}
+
+		if held {
+			// jobs may become eligible without the queue changing, e.g. when a
+			// hot folder's automatic conversion is turned back on
+			timer := time.AfterFunc(ineligibleRecheck, queueChanged.Broadcast)
+			queueChanged.Wait()
+			timer.Stop()
+		} else {
+			queueChanged.Wait()
+		}
+	}
+}
+
+// Dequeue removes a waiting job from the queue, false if it wasn't waiting
+func Dequeue(fileId string) bool {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	if !removeJob(fileId) {
+		return false
+	}
+	delete(pending, fileId)
+	queueChanged.Broadcast()
+	return true
+}
+
+func removeJob(fileId string) bool {
+	idx := slices.IndexFunc(waiting, func(job queuedJob) bool { return job.fileId == fileId })
+	if idx < 0 {
+		return false
+	}
+	waiting = slices.Delete(waiting, idx, idx+1)
+	return true
+}
+
+// IsPending checks if a file is queued or converting
+func IsPending(fileId string) bool {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	return pending[fileId]
+}
+
+// Release marks a file as no longer queued or converting
+func Release(fileId string) {
+	queueMutex.Lock()
+	delete(pending, fileId)
+	queueMutex.Unlock()
+}
+
+// GetPolicy returns the active schedule policy
+func GetPolicy() types.SchedulePolicy {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	return policy
+}
+
+// SetPolicy changes how the next job is picked from the queue
+func SetPolicy(p types.SchedulePolicy) error {
+	if !p.Valid() {
+		return types.ErrUnknownPolicy
+	}
+	queueMutex.Lock()
+	policy = p
+	queueChanged.Broadcast()
+	queueMutex.Unlock()
+	return nil
+}
+
+// QueuedJobs lists the waiting jobs in the order they will be converted
+func QueuedJobs() []types.QueueEntry {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	entries := []types.QueueEntry{}
+	for _, job := range orderedJobs() {
+		file, ok := GetFile(job.fileId)
+		if !ok {
+			continue
+		}
+		entries = append(entries, types.QueueEntry{
+			FileID:    file.ID,
+			FilePath:  file.FilePath,
+			HotFolder: file.HotFolder,
+			Duration:  file.Duration,
+			Priority:  file.Priority,
+			Position:  len(entries),
+		})
+	}
+	return entries
+}
+
+// SetJobPriority changes the priority of a queued job
+func SetJobPriority(fileId string, priority int) (types.File, error) {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	if !slices.ContainsFunc(waiting, func(job queuedJob) bool { return job.fileId == fileId }) {
+		return types.File{}, types.ErrNotQueued
+	}
+	file, ok := ModifyFile(fileId, func(file *types.File) {
+		file.Priority = priority
+	})
+	if !ok {
+		return file, types.ErrFileNotFound
+	}
+	queueChanged.Broadcast()
+	return file, nil
+}
+
+// MoveJob moves a queued job to a position in the order reported by
+// QueuedJobs, a position the priorities or the policy would undo is rejected
+func MoveJob(fileId string, position int) error {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	jobs := orderedJobs()
+	from := slices.IndexFunc(jobs, func(job queuedJob) bool { return job.fileId == fileId })
+	if from < 0 {
+		return types.ErrNotQueued
+	}
+	moved := jobs[from]
+	jobs = slices.Delete(jobs, from, from+1)
+	position = max(0, min(position, len(jobs)))
+	jobs = slices.Insert(jobs, position, moved)
+
+	prevWaiting, prevOrder := waiting, nextOrder
+	for i := range jobs {
+		jobs[i].order = i
+	}
+	waiting = jobs
+	nextOrder = len(jobs)
+	if slices.IndexFunc(orderedJobs(), func(job queuedJob) bool { return job.fileId == fileId }) != position {
+		waiting, nextOrder = prevWaiting, prevOrder
+		return types.ErrInvalidPosition
+	}
+	queueChanged.Broadcast()
+	markDirty()
+	return nil
+}
+
+// waitingOrder returns the IDs of the waiting jobs in their queueing or manual
+// order, the order the priorities and the policy are applied to
+func waitingOrder() []string {
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	jobs := slices.Clone(waiting)
+	slices.SortFunc(jobs, func(a, b queuedJob) int { return a.order - b.order })
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.fileId
+	}
+	return ids
+}
+
+// orderedJobs sorts the waiting jobs by priority and then by the policy,
+// the queue mutex must be held
+func orderedJobs() []queuedJob {
+	type candidate struct {
+		job  queuedJob
+		file types.File
+	}
+	candidates := []candidate{}
+	for _, job := range waiting {
+		file, _ := GetFile(job.fileId)
+		candidates = append(candidates, candidate{job, file})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.file.Priority != b.file.Priority {
+			return a.file.Priority > b.file.Priority
+		}
+		if policy == types.ScheduleShortest && a.file.Duration != b.file.Duration {
+			// files that couldn't be probed go last
+			if a.file.Duration <= 0 || b.file.Duration <= 0 {
+				return b.file.Duration <= 0
+			}
+			return a.file.Duration < b.file.Duration
+		}
+		return a.job.order < b.job.order
+	})
+
+	ordered := make([]queuedJob, 0, len(candidates))
+	if policy != types.ScheduleRoundRobin {
+		for _, c := range candidates {
+			ordered = append(ordered, c.job)
+		}
+		return ordered
+	}
+
+	// take one job from each hot folder in turn, starting after the folder of
+	// the last job picked, without mixing priorities
+	folder := lastFolder
+	for len(candidates) > 0 {
+		top := candidates[0].file.Priority
+		folders := []string{}
+		for _, c := range candidates {
+			if c.file.Priority == top && !slices.Contains(folders, c.file.HotFolder) {
+				folders = append(folders, c.file.HotFolder)
+			}
+		}
+		sort.Strings(folders)
+		next := folders[0]
+		for _, name := range folders {
+			if name > folder {
+				next = name
+				break
+			}
+		}
+
+		idx := slices.IndexFunc(candidates, func(c candidate) bool {
+			return c.file.Priority == top && c.file.HotFolder == next
+		})
+		ordered = append(ordered, candidates[idx].job)
+		candidates = slices.Delete(candidates, idx, idx+1)
+		folder = next
+	}
+	return ordered
+}
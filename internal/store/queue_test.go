@@ -0,0 +1,126 @@
+package store
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	// loading the presets at init writes a blank config next to the tests
+	if data, err := os.ReadFile(*opts.PresetConfigPath); err == nil && string(data) == `{"presets":[]}` {
+		os.Remove(*opts.PresetConfigPath)
+	}
+	os.Exit(m.Run())
+}
+
+// queueJobs tracks and queues a job for each file in order, on an empty queue
+// scheduled with the policy
+func queueJobs(t *testing.T, p types.SchedulePolicy, files ...types.File) {
+	t.Helper()
+	queueMutex.Lock()
+	waiting, pending, nextOrder, policy, lastFolder = nil, map[string]bool{}, 0, p, ""
+	queueMutex.Unlock()
+	for _, file := range files {
+		file.Status = types.Queued
+		UpdateFile(file)
+		if !Enqueue(file) {
+			t.Fatalf("%s was not queued", file.ID)
+		}
+	}
+	t.Cleanup(func() {
+		for _, file := range files {
+			RemoveFile(file.ID)
+		}
+	})
+}
+
+func queueOrder() []string {
+	var ids []string
+	for _, entry := range QueuedJobs() {
+		ids = append(ids, entry.FileID)
+	}
+	return ids
+}
+
+func TestMoveJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   types.SchedulePolicy
+		files    []types.File
+		move     string
+		position int
+		wantErr  error
+		want     []string
+	}{
+		{"fifo to the front", types.ScheduleFIFO,
+			[]types.File{{ID: "a"}, {ID: "b"}, {ID: "c"}}, "c", 0, nil, []string{"c", "a", "b"}},
+		{"fifo to the back", types.ScheduleFIFO,
+			[]types.File{{ID: "a"}, {ID: "b"}, {ID: "c"}}, "a", 5, nil, []string{"b", "c", "a"}},
+		{"above a higher priority", types.ScheduleFIFO,
+			[]types.File{{ID: "a", Priority: 1}, {ID: "b"}, {ID: "c"}}, "c", 0, types.ErrInvalidPosition, []string{"a", "b", "c"}},
+		{"within a priority", types.ScheduleFIFO,
+			[]types.File{{ID: "a", Priority: 1}, {ID: "b"}, {ID: "c"}}, "c", 1, nil, []string{"a", "c", "b"}},
+		{"shortest first undoes the move", types.ScheduleShortest,
+			[]types.File{{ID: "a", Duration: 30}, {ID: "b", Duration: 10}, {ID: "c", Duration: 20}}, "a", 0, types.ErrInvalidPosition, []string{"b", "c", "a"}},
+		{"shortest first among equal durations", types.ScheduleShortest,
+			[]types.File{{ID: "a", Duration: 10}, {ID: "b", Duration: 10}, {ID: "c", Duration: 20}}, "b", 0, nil, []string{"b", "a", "c"}},
+		{"round-robin within a folder", types.ScheduleRoundRobin,
+			[]types.File{{ID: "a", HotFolder: "x"}, {ID: "b", HotFolder: "y"}, {ID: "c", HotFolder: "x"}}, "c", 0, nil, []string{"c", "b", "a"}},
+		{"round-robin across folders", types.ScheduleRoundRobin,
+			[]types.File{{ID: "a", HotFolder: "x"}, {ID: "b", HotFolder: "y"}, {ID: "c", HotFolder: "x"}}, "b", 0, types.ErrInvalidPosition, []string{"a", "b", "c"}},
+		{"not queued", types.ScheduleFIFO,
+			[]types.File{{ID: "a"}}, "z", 0, types.ErrNotQueued, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queueJobs(t, tt.policy, tt.files...)
+			if err := MoveJob(tt.move, tt.position); err != tt.wantErr {
+				t.Errorf("MoveJob() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := queueOrder(); !slices.Equal(got, tt.want) {
+				t.Errorf("queue order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextJobFollowsMoves(t *testing.T) {
+	queueJobs(t, types.ScheduleFIFO, types.File{ID: "a"}, types.File{ID: "b"}, types.File{ID: "c"})
+	if err := MoveJob("c", 0); err != nil {
+		t.Fatal(err)
+	}
+	// jobs queued after a move go to the back
+	late := types.File{ID: "d", Status: types.Queued}
+	UpdateFile(late)
+	Enqueue(late)
+	t.Cleanup(func() { RemoveFile("d") })
+
+	all := func(types.File) bool { return true }
+	var picked []string
+	for range 4 {
+		picked = append(picked, NextJob(all).ID)
+	}
+	if want := []string{"c", "a", "b", "d"}; !slices.Equal(picked, want) {
+		t.Errorf("picked %v, want %v", picked, want)
+	}
+}
+
+func TestRoundRobinAlternatesFolders(t *testing.T) {
+	queueJobs(t, types.ScheduleRoundRobin,
+		types.File{ID: "x1", HotFolder: "x"}, types.File{ID: "x2", HotFolder: "x"}, types.File{ID: "x3", HotFolder: "x"},
+		types.File{ID: "y1", HotFolder: "y"},
+		types.File{ID: "z1", HotFolder: "z"}, types.File{ID: "z2", HotFolder: "z"},
+	)
+	all := func(types.File) bool { return true }
+	var picked []string
+	for range 6 {
+		picked = append(picked, NextJob(all).ID)
+	}
+	if want := []string{"x1", "y1", "z1", "x2", "z2", "x3"}; !slices.Equal(picked, want) {
+		t.Errorf("picked %v, want %v", picked, want)
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"blockbuffer/internal/io"
+	types "blockbuffer/internal/types"
+)
+
+const sampleDir = "blockbuffer-previews"
+
+var samplesMutex = &sync.Mutex{}
+var samples = make(map[string]types.Sample) // sample ID to preview encode
+
+// SampleDir returns the temporary directory preview encodes are written to
+func SampleDir() string {
+	return filepath.Join(os.TempDir(), sampleDir)
+}
+
+// ClearSamples removes preview encodes left behind by a previous run
+func ClearSamples() {
+	if err := os.RemoveAll(SampleDir()); err != nil {
+		io.Logf("Error clearing previews: %v", io.Error, err)
+	}
+}
+
+// AddSample tracks a preview encode and removes it once it expires
+func AddSample(sample types.Sample) {
+	samplesMutex.Lock()
+	samples[sample.ID] = sample
+	samplesMutex.Unlock()
+	time.AfterFunc(time.Until(sample.Expires), func() {
+		RemoveSample(sample.ID)
+	})
+}
+
+// GetSample returns a preview encode that hasn't expired
+func GetSample(sampleId string) (types.Sample, bool) {
+	samplesMutex.Lock()
+	defer samplesMutex.Unlock()
+	sample, ok := samples[sampleId]
+	return sample, ok
+}
+
+// RemoveSample stops tracking a preview encode and deletes its file
+func RemoveSample(sampleId string) error {
+	samplesMutex.Lock()
+	sample, ok := samples[sampleId]
+	delete(samples, sampleId)
+	samplesMutex.Unlock()
+	if !ok {
+		return types.ErrSampleNotFound
+	}
+	if err := os.Remove(sample.FilePath); err != nil && !os.IsNotExist(err) {
+		io.Logf("Error deleting preview %s: %v", io.Error, sample.FilePath, err)
+	}
+	return nil
+}
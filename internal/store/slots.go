@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	opts "blockbuffer/internal/settings"
+	types "blockbuffer/internal/types"
+)
+
+const MaxConcurrency = 64 // upper bound for the conversion pool
+
+var slotsMutex = &sync.Mutex{}
+var slotFreed = sync.NewCond(slotsMutex)
+var running int // number of conversion slots in use
+
+// AcquireSlot blocks until a conversion slot is free and takes it
+func AcquireSlot() {
+	slotsMutex.Lock()
+	defer slotsMutex.Unlock()
+	for running >= *opts.MaxConcurrent {
+		slotFreed.Wait()
+	}
+	running++
+}
+
+// AcquireSlotContext blocks until a conversion slot is free and takes it, or
+// returns the error of the context if it is done first
+func AcquireSlotContext(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		slotsMutex.Lock()
+		slotFreed.Broadcast()
+		slotsMutex.Unlock()
+	})
+	defer stop()
+
+	slotsMutex.Lock()
+	defer slotsMutex.Unlock()
+	for running >= *opts.MaxConcurrent {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		slotFreed.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	running++
+	return nil
+}
+
+// ReleaseSlot frees a conversion slot
+func ReleaseSlot() {
+	slotsMutex.Lock()
+	running--
+	slotFreed.Broadcast()
+	slotsMutex.Unlock()
+}
+
+// Concurrency returns the number of conversions allowed to run at once
+func Concurrency() int {
+	slotsMutex.Lock()
+	defer slotsMutex.Unlock()
+	return *opts.MaxConcurrent
+}
+
+// SetConcurrency resizes the conversion pool, added slots are used right away
+// and running conversions above a lower limit are left to finish
+func SetConcurrency(limit int) error {
+	if limit < 1 || limit > MaxConcurrency {
+		return types.ErrInvalidConcurrency
+	}
+	slotsMutex.Lock()
+	*opts.MaxConcurrent = limit
+	slotFreed.Broadcast()
+	slotsMutex.Unlock()
+	return nil
+}
+
+// RunningConversions returns the number of conversion slots in use
+func RunningConversions() int {
+	slotsMutex.Lock()
+	defer slotsMutex.Unlock()
+	return running
+}
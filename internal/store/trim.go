@@ -0,0 +1,39 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+
+	types "blockbuffer/internal/types"
+)
+
+var pendingTrimsMutex = &sync.Mutex{}
+var pendingTrims = make(map[string]types.Trim) // absolute source path to the trim requested before the job exists
+
+// SetPendingTrim records a trim for a source that hasn't been queued yet,
+// e.g. an upload still being moved into the watch folder
+func SetPendingTrim(filePath string, trim types.Trim) {
+	pendingTrimsMutex.Lock()
+	defer pendingTrimsMutex.Unlock()
+	pendingTrims[absPath(filePath)] = trim
+}
+
+// TakePendingTrim returns and forgets the trim recorded for a source, if any
+func TakePendingTrim(filePath string) *types.Trim {
+	pendingTrimsMutex.Lock()
+	defer pendingTrimsMutex.Unlock()
+	key := absPath(filePath)
+	trim, ok := pendingTrims[key]
+	if !ok {
+		return nil
+	}
+	delete(pendingTrims, key)
+	return &trim
+}
+
+func absPath(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
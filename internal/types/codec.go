@@ -0,0 +1,68 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CodecList is an ordered list of encoder candidates for a preset, the first
+// candidate usable on this machine is picked when a job starts. A single
+// candidate is written as a plain string
+type CodecList []string
+
+func (c *CodecList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*c = nil
+		if single = strings.TrimSpace(single); single != "" {
+			*c = CodecList{single}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*c = nil
+	for _, name := range list {
+		if name = strings.TrimSpace(name); name != "" {
+			*c = append(*c, name)
+		}
+	}
+	return nil
+}
+
+func (c CodecList) MarshalJSON() ([]byte, error) {
+	switch len(c) {
+	case 0:
+		return json.Marshal("")
+	case 1:
+		return json.Marshal(c[0])
+	}
+	return json.Marshal([]string(c))
+}
+
+func (c CodecList) String() string {
+	return strings.Join(c, ", ")
+}
+
+// Resolve returns the first candidate that can be used on this machine, copy
+// is always usable. Until encoders are detected the first candidate is used
+func (c CodecList) Resolve(encType EncoderType) (string, bool) {
+	if len(c) == 0 {
+		return "", false
+	}
+	if ListEncoders() == nil {
+		return c[0], true
+	}
+	for _, name := range c {
+		if name == CopyCodec {
+			return name, true
+		}
+		if encoder, ok := FindEncoder(name, encType); ok && encoder.Unavailable == "" {
+			return name, true
+		}
+	}
+	return "", false
+}
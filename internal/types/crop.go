@@ -0,0 +1,59 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCrop = errors.New("invalid crop")
+
+// CropRect is a crop of the video in display orientation
+type CropRect struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
+
+// Validate checks the rectangle fits in a frame of the given size, a frame of
+// unknown size only checks the rectangle itself
+func (c CropRect) Validate(width int, height int) error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return fmt.Errorf("%w: width and height are required", ErrInvalidCrop)
+	}
+	if c.X < 0 || c.Y < 0 {
+		return fmt.Errorf("%w: offsets must not be negative", ErrInvalidCrop)
+	}
+	if width > 0 && height > 0 && (c.X+c.Width > width || c.Y+c.Height > height) {
+		return fmt.Errorf("%w: %dx%d at %d,%d exceeds the %dx%d frame", ErrInvalidCrop, c.Width, c.Height, c.X, c.Y, width, height)
+	}
+	return nil
+}
+
+// Covers reports whether the rectangle keeps the whole of a frame of the given size
+func (c CropRect) Covers(width int, height int) bool {
+	return c.X <= 0 && c.Y <= 0 && c.Width >= width && c.Height >= height
+}
+
+// Filter returns the crop as a preset filter
+func (c CropRect) Filter() Filter {
+	x, y := c.X, c.Y
+	return Filter{Type: FilterCrop, Width: c.Width, Height: c.Height, X: &x, Y: &y}
+}
+
+// Crop is the crop of a job, applied to the outputs of presets with auto-crop
+type Crop struct {
+	Detected *CropRect `json:"detected,omitempty"` // found by the crop detection pass
+	Override *CropRect `json:"override,omitempty"` // set through the API, replaces the detected crop
+}
+
+// Rect returns the crop applied to the job, nil until it is detected or overridden
+func (c *Crop) Rect() *CropRect {
+	if c == nil {
+		return nil
+	}
+	if c.Override != nil {
+		return c.Override
+	}
+	return c.Detected
+}
@@ -1,10 +1,17 @@
 package types
 
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
 type EncoderType string
 
 const (
-	Video EncoderType = "V"
-	Audio EncoderType = "A"
+	Video    EncoderType = "V"
+	Audio    EncoderType = "A"
+	Subtitle EncoderType = "S"
 )
 
 type AVOptionEnum struct {
@@ -27,10 +34,85 @@ type Encoder struct {
 	Formats     []string    `json:"formats"`
 	SampleRates []string    `json:"sampleRates"` // empty unless audio
 	Options     []AVOption  `json:"options"`
+	Unavailable string      `json:"unavailable,omitempty"` // reason the encoder can't be used on this machine
+}
+
+// hardwareSuffixes identify encoders that need a device, e.g. a GPU
+var hardwareSuffixes = []string{"_nvenc", "_vaapi", "_qsv", "_amf", "_videotoolbox", "_v4l2m2m", "_mf", "_omx", "_vulkan", "_mediacodec", "_rkmpp"}
+
+// IsHardwareEncoder checks if an encoder needs a hardware device, such
+// encoders are listed by ffmpeg even when the device is missing
+func IsHardwareEncoder(name string) bool {
+	for _, suffix := range hardwareSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
 }
 
+// genericOptions are the encoding options of the AVCodecContext section of
+// `ffmpeg -h full`, accepted by every encoder next to its private options
+var genericOptions = []string{
+	"b", "ab", "bt", "flags", "flags2", "g", "keyint_min", "bf", "refs", "sc_threshold",
+	"qmin", "qmax", "qdiff", "qcomp", "qblur", "b_qfactor", "b_qoffset",
+	"i_qfactor", "i_qoffset", "maxrate", "minrate", "bufsize", "rc_init_occupancy",
+	"threads", "thread_type", "slices", "profile", "level", "strict", "trellis", "mbd",
+	"cmp", "subcmp", "dia_size", "me_range", "coder", "context", "field_order",
+	"frame_size", "compression_level", "cutoff", "ar", "ac",
+}
+
+// IsGenericOption checks if an option is accepted by every encoder
+func IsGenericOption(name string) bool {
+	return slices.Contains(genericOptions, name)
+}
+
+var EncodersMutex = &sync.Mutex{}
 var Encoders []Encoder
 
+// SetEncoders replaces the list of detected encoders
+func SetEncoders(encoders []Encoder) {
+	EncodersMutex.Lock()
+	Encoders = encoders
+	EncodersMutex.Unlock()
+}
+
+// ListEncoders returns a copy of the detected encoders, nil if detection hasn't finished
+func ListEncoders() []Encoder {
+	EncodersMutex.Lock()
+	defer EncodersMutex.Unlock()
+	if Encoders == nil {
+		return nil
+	}
+	return append([]Encoder{}, Encoders...)
+}
+
+// FindEncoder returns the detected encoder with the given name and type
+func FindEncoder(name string, encType EncoderType) (Encoder, bool) {
+	EncodersMutex.Lock()
+	defer EncodersMutex.Unlock()
+	for _, encoder := range Encoders {
+		if encoder.Name == name && encoder.Type == encType {
+			return encoder, true
+		}
+	}
+	return Encoder{}, false
+}
+
+// MarkUnavailable records that a detected encoder can't be used, false if the
+// encoder isn't detected or was already marked
+func MarkUnavailable(name string, encType EncoderType, reason string) bool {
+	EncodersMutex.Lock()
+	defer EncodersMutex.Unlock()
+	for i, encoder := range Encoders {
+		if encoder.Name == name && encoder.Type == encType && encoder.Unavailable == "" {
+			Encoders[i].Unavailable = reason
+			return true
+		}
+	}
+	return false
+}
+
 type AVProfileOption struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
@@ -1,11 +1,14 @@
 package types
 
+import "time"
+
 type FileStatus string
 
 const (
 	New             FileStatus = "new"
 	Queued          FileStatus = "queued"
 	Processing      FileStatus = "processing"
+	Paused          FileStatus = "paused"
 	Completed       FileStatus = "completed"
 	CompleteDeleted FileStatus = "completed-deleted"
 	Cancelled       FileStatus = "cancelled"
@@ -14,10 +17,125 @@ const (
 	Deleted         FileStatus = "deleted"
 )
 
+// Output is a single conversion target of a file, produced by one output rule
+type Output struct {
+	Preset       string        `json:"preset"`
+	OutputDir    string        `json:"outputDir"`
+	FilePath     string        `json:"filePath"`
+	Status       FileStatus    `json:"status"`
+	Progress     float32       `json:"progress"`
+	Error        string        `json:"error,omitempty"`
+	Reason       FailureReason `json:"reason,omitempty"`
+	Attempts     int           `json:"attempts"`
+	VideoEncoder string        `json:"videoEncoder,omitempty"` // encoder picked from the preset candidates
+	AudioEncoder string        `json:"audioEncoder,omitempty"`
+	Package      PackageFormat `json:"package,omitempty"`   // set when the output is a directory of playlists and segments
+	Subtitles    []string      `json:"subtitles,omitempty"` // subtitle files written next to the output
+}
+
+type FailureReason string
+
+const (
+	InputUnreadable FailureReason = "input_unreadable"
+	EncoderMissing  FailureReason = "encoder_missing"
+	DiskFull        FailureReason = "disk_full"
+	DeviceBusy      FailureReason = "device_busy" // a hardware encoder is out of sessions or memory
+	CancelledByUser FailureReason = "cancelled"
+	InvalidPreset   FailureReason = "invalid_preset" // the preset can't be applied to the source
+	UnknownFailure  FailureReason = "unknown"
+)
+
+// Transient reports whether a failure may succeed when retried
+func (r FailureReason) Transient() bool {
+	return r == DiskFull || r == DeviceBusy || r == UnknownFailure
+}
+
+// StatusChange records when a file entered a status
+type StatusChange struct {
+	Status FileStatus `json:"status"`
+	Time   time.Time  `json:"time"`
+}
+
 type File struct {
-	ID       string     `json:"id"`
-	FilePath string     `json:"filePath"`
-	Status   FileStatus `json:"status"`
-	Progress float32    `json:"progress"`
-	Duration float64    `json:"duration"`
+	ID        string         `json:"id"`
+	FilePath  string         `json:"filePath"`
+	WatchDir  string         `json:"watchDir,omitempty"`  // watch directory the file was found in
+	HotFolder string         `json:"hotFolder,omitempty"` // name of the hot folder the file was found in
+	Status    FileStatus     `json:"status"`
+	Progress  float32        `json:"progress"`
+	Duration  float64        `json:"duration"`       // seconds to convert, the length of the trim range when trimmed
+	Trim      *Trim          `json:"trim,omitempty"` // section of the source to convert, nil for all of it
+	Crop      *Crop          `json:"crop,omitempty"` // applied to outputs of presets with auto-crop
+	Media     *MediaInfo     `json:"media,omitempty"`
+	Subtitles []SubtitleFile `json:"subtitles,omitempty"` // subtitle files next to the source
+	Previews  Previews       `json:"previews"`
+	Outputs   []Output       `json:"outputs"`
+	Error     string         `json:"error,omitempty"`
+	Force     bool           `json:"force,omitempty"`    // overwrite existing outputs, set when requeued
+	Priority  int            `json:"priority,omitempty"` // higher priority jobs are converted first
+	History   []StatusChange `json:"history,omitempty"`
+}
+
+// Previews lists the images extracted from the source
+type Previews struct {
+	Thumbnail    bool `json:"thumbnail"`    // poster frame, served at /api/files/{id}/thumbnail
+	ContactSheet bool `json:"contactSheet"` // grid of frames across the source, served at /api/files/{id}/contact-sheet
+}
+
+// SetMedia stores the probed media of the source and updates the duration to convert
+func (f *File) SetMedia(media *MediaInfo) {
+	f.Media = media
+	f.Duration = f.Trim.Length(f.SourceDuration())
+}
+
+// SetTrim limits the conversion to a section of the source, nil converts all of it
+func (f *File) SetTrim(trim *Trim) {
+	f.Trim = trim
+	f.Duration = f.Trim.Length(f.SourceDuration())
+}
+
+// SourceDuration returns the duration of the whole source, 0 if it couldn't be probed
+func (f *File) SourceDuration() float64 {
+	if f.Media == nil {
+		return 0
+	}
+	return f.Media.Duration
+}
+
+// Summarize derives the file status and progress from the status of its outputs
+func (f *File) Summarize() {
+	if len(f.Outputs) == 0 {
+		return
+	}
+
+	var total float32
+	counts := make(map[FileStatus]int)
+	for _, output := range f.Outputs {
+		counts[output.Status]++
+		if output.Status == Completed || output.Status == Rejected {
+			total += 100
+		} else {
+			total += output.Progress
+		}
+	}
+
+	n := len(f.Outputs)
+	f.Progress = total / float32(n)
+	done := counts[Completed] + counts[Rejected]
+	switch {
+	case counts[Paused] > 0:
+		f.Status = Paused
+	case counts[Rejected] == n:
+		f.Status = Rejected
+	case done == n:
+		f.Status = Completed
+	case counts[Cancelled] > 0 && done+counts[Failed]+counts[Cancelled] == n:
+		f.Status = Cancelled
+	case counts[Failed] > 0 && done+counts[Failed] == n:
+		f.Status = Failed
+	case counts[Queued] > 0 && counts[Processing] == 0:
+		f.Status = Queued
+	default:
+		f.Status = Processing
+	}
 }
@@ -0,0 +1,162 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+type FilterType string
+
+const (
+	FilterDeinterlace FilterType = "deinterlace" // method yadif (default) or bwdif, progressive frames pass through
+	FilterCrop        FilterType = "crop"        // width and height, x and y default to a centred crop
+	FilterDenoise     FilterType = "denoise"     // method hqdn3d (default) or nlmeans, strength 0 for the filter default
+	FilterLUT         FilterType = "lut"         // file of a 3D LUT, e.g. a .cube file
+	FilterFPS         FilterType = "fps"         // rate, e.g. 25 or 30000/1001
+	FilterRotate      FilterType = "rotate"      // angle of 90, 180 or 270 degrees clockwise
+	FilterResample    FilterType = "resample"    // audio, rate in Hz, e.g. 48000
+	FilterVolume      FilterType = "volume"      // audio, gain as a factor or in dB, e.g. 0.5 or -3dB
+)
+
+// filterStreams is the stream type each filter applies to
+var filterStreams = map[FilterType]StreamType{
+	FilterDeinterlace: VideoStream,
+	FilterCrop:        VideoStream,
+	FilterDenoise:     VideoStream,
+	FilterLUT:         VideoStream,
+	FilterFPS:         VideoStream,
+	FilterRotate:      VideoStream,
+	FilterResample:    AudioStream,
+	FilterVolume:      AudioStream,
+}
+
+// Filter is one step of the filter chain of a preset, only the fields of its
+// type are used
+type Filter struct {
+	Type     FilterType `json:"type"`
+	Method   string     `json:"method,omitempty"`
+	Width    int        `json:"width,omitempty"`
+	Height   int        `json:"height,omitempty"`
+	X        *int       `json:"x,omitempty"` // nil centres the crop
+	Y        *int       `json:"y,omitempty"`
+	Strength float64    `json:"strength,omitempty"`
+	File     string     `json:"file,omitempty"`
+	Rate     string     `json:"rate,omitempty"`
+	Angle    int        `json:"angle,omitempty"`
+	Gain     string     `json:"gain,omitempty"`
+}
+
+// FilterName returns the ffmpeg filter a filter compiles to
+func (f Filter) FilterName() string {
+	switch f.Type {
+	case FilterDeinterlace:
+		return defaultString(f.Method, "yadif")
+	case FilterDenoise:
+		return defaultString(f.Method, "hqdn3d")
+	case FilterLUT:
+		return "lut3d"
+	case FilterRotate:
+		return "transpose"
+	case FilterResample:
+		return "aresample"
+	}
+	return string(f.Type)
+}
+
+func defaultString(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+var FiltersMutex = &sync.Mutex{}
+var Filters []string
+
+// SetFilters replaces the list of filters detected in the local ffmpeg
+func SetFilters(filters []string) {
+	FiltersMutex.Lock()
+	Filters = filters
+	FiltersMutex.Unlock()
+}
+
+// FilterAvailable reports whether the local ffmpeg has a filter, every filter
+// is assumed available until detection has finished
+func FilterAvailable(name string) bool {
+	FiltersMutex.Lock()
+	defer FiltersMutex.Unlock()
+	return Filters == nil || slices.Contains(Filters, name)
+}
+
+var (
+	frameRateValue = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(/[0-9]+)?$`)
+	gainValue      = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)(dB)?$`)
+)
+
+// validateFilters checks each filter of a chain applies to the stream type of
+// the chain, has the values its type requires and exists in the local ffmpeg
+func validateFilters(prefix string, filters []Filter, streamType StreamType, errs FieldErrors) {
+	for i, f := range filters {
+		field := fmt.Sprintf("%s.filters.%d", prefix, i)
+		filterType, ok := filterStreams[f.Type]
+		if !ok {
+			errs[field+".type"] = fmt.Sprintf("unknown filter %s, expected one of: deinterlace, crop, denoise, lut, fps, rotate, resample, volume", f.Type)
+			continue
+		}
+		if filterType != streamType {
+			errs[field+".type"] = fmt.Sprintf("%s is a %s filter", f.Type, filterType)
+			continue
+		}
+
+		switch f.Type {
+		case FilterDeinterlace:
+			if f.Method != "" && f.Method != "yadif" && f.Method != "bwdif" {
+				errs[field+".method"] = "expected one of: yadif, bwdif"
+			}
+		case FilterCrop:
+			if f.Width <= 0 || f.Height <= 0 {
+				errs[field] = "crop requires a width and height"
+			}
+			if (f.X != nil && *f.X < 0) || (f.Y != nil && *f.Y < 0) {
+				errs[field] = "crop offsets must not be negative"
+			}
+		case FilterDenoise:
+			if f.Method != "" && f.Method != "hqdn3d" && f.Method != "nlmeans" {
+				errs[field+".method"] = "expected one of: hqdn3d, nlmeans"
+			}
+			if f.Strength < 0 {
+				errs[field+".strength"] = "strength must not be negative"
+			}
+		case FilterLUT:
+			if f.File == "" {
+				errs[field+".file"] = "lut requires a file"
+			} else if _, err := os.Stat(f.File); err != nil {
+				errs[field+".file"] = fmt.Sprintf("lut file %s not found", f.File)
+			}
+		case FilterFPS:
+			if !frameRateValue.MatchString(f.Rate) {
+				errs[field+".rate"] = "expected a frame rate, e.g. 25 or 30000/1001"
+			}
+		case FilterRotate:
+			if f.Angle != 90 && f.Angle != 180 && f.Angle != 270 {
+				errs[field+".angle"] = "expected one of: 90, 180, 270"
+			}
+		case FilterResample:
+			if rate, err := strconv.Atoi(f.Rate); err != nil || rate <= 0 {
+				errs[field+".rate"] = "expected a sample rate, e.g. 48000"
+			}
+		case FilterVolume:
+			if !gainValue.MatchString(f.Gain) {
+				errs[field+".gain"] = "expected a factor or a gain in dB, e.g. 0.5 or -3dB"
+			}
+		}
+
+		if !FilterAvailable(f.FilterName()) {
+			errs[field] = fmt.Sprintf("ffmpeg has no %s filter", f.FilterName())
+		}
+	}
+}
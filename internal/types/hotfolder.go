@@ -0,0 +1,102 @@
+package types
+
+import (
+	"path/filepath"
+	"sync"
+
+	"blockbuffer/internal/io"
+	opts "blockbuffer/internal/settings"
+)
+
+const DefaultHotFolder = "default"
+
+// HotFolder is a watched input directory with its own outputs and conversion settings
+type HotFolder struct {
+	Name        string   `json:"name"`
+	WatchDir    string   `json:"watchDir"`
+	OutputDir   string   `json:"outputDir"`             // empty uses --output-dir
+	Presets     []string `json:"presets"`               // one output per preset, empty uses the output rules
+	AutoConvert *bool    `json:"autoConvert,omitempty"` // nil uses the global setting
+	DeleteAfter *bool    `json:"deleteAfter,omitempty"` // nil uses the global setting
+	Default     bool     `json:"default,omitempty"`     // built from the command line flags
+}
+
+var HotFoldersMutex = &sync.Mutex{}
+var HotFolders []HotFolder // HotFolders are the folders configured in the preset config
+
+// ListHotFolders returns the default hot folder followed by the configured hot folders
+func ListHotFolders() []HotFolder {
+	folders := []HotFolder{{
+		Name:      DefaultHotFolder,
+		WatchDir:  *opts.WatchDir,
+		OutputDir: *opts.OutputDir,
+		Presets:   []string{},
+		Default:   true,
+	}}
+
+	HotFoldersMutex.Lock()
+	defer HotFoldersMutex.Unlock()
+	return append(folders, HotFolders...)
+}
+
+// GetHotFolder returns the hot folder with the given name, falling back to the default folder
+func GetHotFolder(name string) HotFolder {
+	folders := ListHotFolders()
+	for _, folder := range folders {
+		if folder.Name == name {
+			return folder
+		}
+	}
+	return folders[0]
+}
+
+// ShouldAutoConvert reports whether files in the folder are converted automatically
+func (h HotFolder) ShouldAutoConvert() bool {
+	if h.AutoConvert != nil {
+		return *h.AutoConvert
+	}
+	return *opts.AutoConvert
+}
+
+// ShouldDeleteAfter reports whether sources in the folder are deleted after conversion
+func (h HotFolder) ShouldDeleteAfter() bool {
+	if h.DeleteAfter != nil {
+		return *h.DeleteAfter
+	}
+	return *opts.DeleteAfter
+}
+
+// loadHotFolders fills in defaults for configured hot folders and drops invalid entries
+func loadHotFolders(folders []HotFolder) {
+	names := map[string]bool{DefaultHotFolder: true}
+	HotFoldersMutex.Lock()
+	defer HotFoldersMutex.Unlock()
+	HotFolders = nil
+	for _, folder := range folders {
+		if folder.WatchDir == "" {
+			io.Logf("Hot folder %s has no watch directory, skipping", io.Warn, folder.Name)
+			continue
+		}
+		if folder.Name == "" {
+			folder.Name = filepath.Base(folder.WatchDir)
+		}
+		if names[folder.Name] {
+			io.Logf("Duplicate hot folder name %s, skipping", io.Warn, folder.Name)
+			continue
+		}
+		if folder.OutputDir == "" {
+			folder.OutputDir = *opts.OutputDir
+		}
+		if folder.Presets == nil {
+			folder.Presets = []string{}
+		}
+		for _, preset := range folder.Presets {
+			if _, ok := Presets[preset]; !ok {
+				io.Logf("Hot folder %s uses unknown preset %s", io.Warn, folder.Name, preset)
+			}
+		}
+		folder.Default = false
+		names[folder.Name] = true
+		HotFolders = append(HotFolders, folder)
+	}
+}
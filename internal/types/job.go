@@ -0,0 +1,56 @@
+package types
+
+import "errors"
+
+type JobAction string
+
+const (
+	CancelJob  JobAction = "cancel"
+	PauseJob   JobAction = "pause"
+	ResumeJob  JobAction = "resume"
+	RequeueJob JobAction = "requeue"
+)
+
+// Command is a job control request sent by a client over the websocket
+type Command struct {
+	Command JobAction `json:"command"`
+	FileID  string    `json:"fileId"`
+}
+
+var ErrFileNotFound = errors.New("file not found")
+var ErrInvalidJobState = errors.New("action not allowed in the current job state")
+var ErrUnknownAction = errors.New("unknown job action")
+
+// SchedulePolicy decides which queued job is converted next, jobs with a
+// higher priority always go first
+type SchedulePolicy string
+
+const (
+	ScheduleFIFO       SchedulePolicy = "fifo"        // in the order jobs were queued
+	ScheduleShortest   SchedulePolicy = "shortest"    // shortest probed duration first
+	ScheduleRoundRobin SchedulePolicy = "round-robin" // alternate between hot folders
+)
+
+// Valid checks if the policy is known
+func (p SchedulePolicy) Valid() bool {
+	switch p {
+	case ScheduleFIFO, ScheduleShortest, ScheduleRoundRobin:
+		return true
+	}
+	return false
+}
+
+// QueueEntry is a job waiting in the queue, listed in the order it will be converted
+type QueueEntry struct {
+	FileID    string  `json:"fileId"`
+	FilePath  string  `json:"filePath"`
+	HotFolder string  `json:"hotFolder"`
+	Duration  float64 `json:"duration"`
+	Priority  int     `json:"priority"`
+	Position  int     `json:"position"`
+}
+
+var ErrNotQueued = errors.New("file is not waiting in the queue")
+var ErrInvalidPosition = errors.New("position conflicts with the job priorities or the schedule policy")
+var ErrUnknownPolicy = errors.New("unknown schedule policy, expected one of: fifo, shortest, round-robin")
+var ErrInvalidConcurrency = errors.New("concurrency must be between 1 and 64")
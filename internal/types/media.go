@@ -0,0 +1,80 @@
+package types
+
+type StreamType string
+
+const (
+	VideoStream    StreamType = "video"
+	AudioStream    StreamType = "audio"
+	SubtitleStream StreamType = "subtitle"
+	DataStream     StreamType = "data"
+	AttachStream   StreamType = "attachment"
+)
+
+// MediaStream describes a single stream of a probed source file
+type MediaStream struct {
+	Index          int        `json:"index"`
+	Type           StreamType `json:"type"`
+	Codec          string     `json:"codec"`
+	Profile        string     `json:"profile,omitempty"`
+	Width          int        `json:"width,omitempty"`
+	Height         int        `json:"height,omitempty"`
+	FrameRate      float64    `json:"frameRate,omitempty"`
+	PixelFormat    string     `json:"pixelFormat,omitempty"`
+	Channels       int        `json:"channels,omitempty"`
+	ChannelLayout  string     `json:"channelLayout,omitempty"`
+	SampleRate     int        `json:"sampleRate,omitempty"`
+	BitRate        int64      `json:"bitRate,omitempty"`
+	Rotation       int        `json:"rotation,omitempty"`
+	ColorSpace     string     `json:"colorSpace,omitempty"`
+	ColorTransfer  string     `json:"colorTransfer,omitempty"`
+	ColorPrimaries string     `json:"colorPrimaries,omitempty"`
+	ColorRange     string     `json:"colorRange,omitempty"`
+	Language       string     `json:"language,omitempty"`
+	Duration       float64    `json:"duration,omitempty"`
+	AttachedPic    bool       `json:"attachedPic,omitempty"` // cover art stored as a video stream
+}
+
+// DisplaySize returns the width and height of the stream as displayed,
+// swapping the dimensions of streams rotated by 90 degrees
+func (s *MediaStream) DisplaySize() (int, int) {
+	if s.Rotation%180 != 0 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
+
+// MediaInfo is the probed metadata of a source file
+type MediaInfo struct {
+	Format   string        `json:"format"`
+	Duration float64       `json:"duration"`
+	BitRate  int64         `json:"bitRate,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+	Timecode string        `json:"timecode,omitempty"` // start timecode, e.g. 01:00:00:00
+	Streams  []MediaStream `json:"streams"`
+}
+
+// Video returns the first video stream that isn't cover art, nil if there is none
+func (m *MediaInfo) Video() *MediaStream {
+	if m == nil {
+		return nil
+	}
+	for i := range m.Streams {
+		if m.Streams[i].Type == VideoStream && !m.Streams[i].AttachedPic {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Audio returns the first audio stream, nil if there is none
+func (m *MediaInfo) Audio() *MediaStream {
+	if m == nil {
+		return nil
+	}
+	for i := range m.Streams {
+		if m.Streams[i].Type == AudioStream {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
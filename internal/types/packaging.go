@@ -0,0 +1,93 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+)
+
+type PackageFormat string
+
+const (
+	PackageHLS  PackageFormat = "hls"  // HLS playlists with MPEG-TS segments
+	PackageDASH PackageFormat = "dash" // DASH manifest with fMP4 segments, plus HLS playlists of the same segments
+)
+
+const DefaultSegmentLength = 6 // seconds
+
+// Rendition is one rung of an adaptive bitrate ladder
+type Rendition struct {
+	Height  int    `json:"height"`  // height of landscape sources, the width of portrait sources
+	Bitrate string `json:"bitrate"` // video bitrate, e.g. 2800k
+}
+
+// DefaultLadder is used by packaged presets without their own ladder
+var DefaultLadder = []Rendition{
+	{Height: 1080, Bitrate: "5000k"},
+	{Height: 720, Bitrate: "2800k"},
+	{Height: 480, Bitrate: "1400k"},
+	{Height: 360, Bitrate: "800k"},
+}
+
+// Packaging turns a preset into a streamable output, written as playlists and
+// segments into a directory per job
+type Packaging struct {
+	Format        PackageFormat `json:"format"`
+	SegmentLength int           `json:"segmentLength,omitempty"` // seconds, defaults to DefaultSegmentLength
+	Ladder        []Rendition   `json:"ladder,omitempty"`        // renditions larger than the source are left out
+}
+
+// Playlist returns the name of the file players open
+func (p *Packaging) Playlist() string {
+	if p.Format == PackageDASH {
+		return "manifest.mpd"
+	}
+	return "master.m3u8"
+}
+
+// Rungs returns the ladder of the preset, or the default ladder
+func (p *Packaging) Rungs() []Rendition {
+	if len(p.Ladder) > 0 {
+		return p.Ladder
+	}
+	return DefaultLadder
+}
+
+// Segment returns the segment length in seconds
+func (p *Packaging) Segment() int {
+	if p.SegmentLength > 0 {
+		return p.SegmentLength
+	}
+	return DefaultSegmentLength
+}
+
+// validatePackaging checks the format and ladder of a packaged preset
+func validatePackaging(p PresetBundle, errs FieldErrors) {
+	packaging := p.Packaging
+	if packaging == nil {
+		return
+	}
+
+	switch packaging.Format {
+	case PackageHLS, PackageDASH:
+	default:
+		errs["packaging.format"] = fmt.Sprintf("unknown packaging format %s, expected hls or dash", packaging.Format)
+	}
+	if packaging.SegmentLength < 0 {
+		errs["packaging.segmentLength"] = "segment length must not be negative"
+	}
+	for i, rung := range packaging.Ladder {
+		field := fmt.Sprintf("packaging.ladder.%d", i)
+		if rung.Height <= 0 {
+			errs[field+".height"] = "height is required"
+		}
+		if _, err := ParseBitrate(rung.Bitrate); err != nil {
+			errs[field+".bitrate"] = err.Error()
+		}
+	}
+	if p.VideoPreset.Rate != nil {
+		errs["video.rateControl"] = "packaged presets take their bitrates from the ladder"
+	}
+	if slices.Contains(p.VideoPreset.Codec, CopyCodec) {
+		errs["video.codec"] = "packaged presets must encode the video to build the ladder"
+	}
+}
@@ -3,7 +3,9 @@ package types
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"os"
+	"sync"
 
 	"blockbuffer/internal/io"
 	opts "blockbuffer/internal/settings"
@@ -43,32 +45,72 @@ func (o Options) MarshalJSON() ([]byte, error) {
 }
 
 type AudioPreset struct {
-	Codec      string   `json:"codec"`
-	SampleRate *string  `json:"sampleRate"`
-	Options    *Options `json:"options"`
+	Codec      CodecList `json:"codec"`
+	SampleRate *string   `json:"sampleRate"`
+	Format     string    `json:"format,omitempty"`   // sample format, e.g. s32 or fltp
+	Channels   int       `json:"channels,omitempty"` // e.g. 1 to downmix to mono, 0 keeps the source layout
+	Bitrate    string    `json:"bitrate,omitempty"`  // e.g. 192k, left to the encoder when empty
+	Options    *Options  `json:"options"`
+	Filters    []Filter  `json:"filters,omitempty"` // applied in order
+}
+
+type ScaleMode string
+
+const (
+	ScaleKeep ScaleMode = "keep" // keep the source size
+	ScaleMax  ScaleMode = "max"  // shrink to fit within width/height, never upscale
+	ScaleFit  ScaleMode = "fit"  // scale to fit within width x height, keeping the aspect ratio
+	ScaleFill ScaleMode = "fill" // scale to cover width x height and crop the overflow
+	ScalePad  ScaleMode = "pad"  // scale to fit within width x height and pad to the exact size
+)
+
+// ScaleRule describes how the output resolution is derived from the source
+type ScaleRule struct {
+	Mode             ScaleMode `json:"mode"`
+	Width            int       `json:"width,omitempty"`            // target or maximum width, 0 for no limit
+	Height           int       `json:"height,omitempty"`           // target or maximum height, 0 for no limit
+	MinWidth         int       `json:"minWidth,omitempty"`         // sources smaller than this are upscaled
+	MinHeight        int       `json:"minHeight,omitempty"`        // sources smaller than this are upscaled
+	Rounding         int       `json:"rounding,omitempty"`         // dimensions are rounded to a multiple of this, defaults to 2
+	MatchOrientation bool      `json:"matchOrientation,omitempty"` // swap width and height for portrait sources
 }
 
 type VideoPreset struct {
-	Codec   string   `json:"codec"`
-	Format  string   `json:"format"`
-	Options *Options `json:"options"`
+	Codec    CodecList    `json:"codec"`
+	Format   string       `json:"format"`
+	Options  *Options     `json:"options"`
+	Scale    *ScaleRule   `json:"scale,omitempty"`       // nil keeps the source size
+	Rate     *RateControl `json:"rateControl,omitempty"` // nil leaves rate control to the encoder options
+	Filters  []Filter     `json:"filters,omitempty"`     // applied in order, before the scale rule
+	AutoCrop bool         `json:"autoCrop,omitempty"`    // crop the black bars found by crop detection, ahead of the filters
 }
 
 type PresetBundle struct {
-	Name        string `json:"name"`
-	Default     *bool
-	Description string      `json:"description"`
-	Extension   string      `json:"extension"`
-	VideoPreset VideoPreset `json:"video"`
-	AudioPreset AudioPreset `json:"audio"`
+	Name        string          `json:"name"`
+	Default     *bool           `json:"default,omitempty"`
+	Description string          `json:"description"`
+	Extension   string          `json:"extension"`
+	VideoPreset VideoPreset     `json:"video"`
+	AudioPreset AudioPreset     `json:"audio"`
+	Packaging   *Packaging      `json:"packaging,omitempty"` // nil writes a single file
+	Streams     *StreamMap      `json:"streams,omitempty"`   // nil leaves stream selection to ffmpeg
+	Subtitles   *SubtitlePreset `json:"subtitles,omitempty"` // nil leaves subtitles to ffmpeg
+}
+
+// AudioOnly reports whether the preset has no video codec, its outputs have no video stream
+func (p PresetBundle) AudioOnly() bool {
+	return len(p.VideoPreset.Codec) == 0
 }
 
 type PresetConfig struct {
-	Presets []PresetBundle `json:"presets"`
+	Presets    []PresetBundle `json:"presets"`
+	Rules      []OutputRule   `json:"rules,omitempty"`
+	HotFolders []HotFolder    `json:"hotFolders,omitempty"`
 }
 
 //go:embed defaults.json
 var embededPresets embed.FS
+var PresetsMutex = &sync.Mutex{}
 var Presets = make(map[string]PresetBundle)
 var DefaultPreset PresetBundle
 
@@ -120,27 +162,78 @@ func loadConfig(path string) {
 	for _, p := range presets.Presets {
 		Presets[p.Name] = p
 	}
+	OutputRules = presets.Rules
+	loadHotFolders(presets.HotFolders)
+}
+
+// GetPreset returns the preset with the given name
+func GetPreset(name string) (PresetBundle, bool) {
+	PresetsMutex.Lock()
+	defer PresetsMutex.Unlock()
+	preset, ok := Presets[name]
+	return preset, ok
 }
 
-func AddPreset(preset PresetBundle) {
+var ErrDefaultPreset = errors.New("default presets cannot be modified")
+var ErrPresetNotFound = errors.New("preset not found")
+
+// IsDefault reports whether the preset is one of the embedded defaults
+func (p PresetBundle) IsDefault() bool {
+	return p.Default != nil && *p.Default
+}
+
+// AddPreset creates or replaces a user preset and saves the preset config
+func AddPreset(preset PresetBundle) error {
+	PresetsMutex.Lock()
+	if existing, ok := Presets[preset.Name]; ok && existing.IsDefault() {
+		PresetsMutex.Unlock()
+		return ErrDefaultPreset
+	}
+	preset.Default = nil
 	Presets[preset.Name] = preset
-	ExportPresets()
+	PresetsMutex.Unlock()
+	return ExportPresets()
 }
 
-func ExportPresets() {
+// RemovePreset deletes a user preset and saves the preset config
+func RemovePreset(name string) error {
+	PresetsMutex.Lock()
+	existing, ok := Presets[name]
+	if !ok {
+		PresetsMutex.Unlock()
+		return ErrPresetNotFound
+	}
+	if existing.IsDefault() {
+		PresetsMutex.Unlock()
+		return ErrDefaultPreset
+	}
+	delete(Presets, name)
+	PresetsMutex.Unlock()
+	return ExportPresets()
+}
+
+func ExportPresets() error {
 	var presets PresetConfig
 	presets = PresetConfig{}
+	PresetsMutex.Lock()
 	for _, preset := range Presets {
 		// only store presets with no Default field or Default set to false
-		if preset.Default == nil || !*preset.Default {
+		if !preset.IsDefault() {
 			presets.Presets = append(presets.Presets, preset)
 		}
 	}
+	PresetsMutex.Unlock()
+	presets.Rules = GetOutputRules()
+	HotFoldersMutex.Lock()
+	presets.HotFolders = HotFolders
+	HotFoldersMutex.Unlock()
 
 	var data, err = json.MarshalIndent(presets, "", "  ")
+	if err == nil {
+		err = os.WriteFile(*opts.PresetConfigPath, data, 0644)
+	}
 	if err != nil {
 		io.Logf("Error exporting presets: %v", io.Error, err)
-	} else {
-		os.WriteFile(*opts.PresetConfigPath, data, 0644)
 	}
+	return err
 }
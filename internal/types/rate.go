@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type RateMode string
+
+const (
+	RateQuality RateMode = "quality" // constant quality, e.g. CRF
+	RateCBR     RateMode = "cbr"     // constant bitrate
+	RateVBR     RateMode = "vbr"     // variable bitrate capped at a peak rate
+	RateTwoPass RateMode = "2pass"   // two-pass average bitrate
+	RateSize    RateMode = "size"    // two-pass with the bitrate derived from a target file size
+)
+
+// RateControl describes how the video encoder spends bits
+type RateControl struct {
+	Mode       RateMode `json:"mode"`
+	Quality    *int     `json:"quality,omitempty"`    // crf or equivalent quality value for quality mode
+	Bitrate    string   `json:"bitrate,omitempty"`    // target bitrate, e.g. 5M
+	MaxRate    string   `json:"maxRate,omitempty"`    // peak bitrate for vbr mode
+	BufSize    string   `json:"bufSize,omitempty"`    // rate control buffer, defaults to twice the peak bitrate
+	TargetSize string   `json:"targetSize,omitempty"` // output size for size mode, e.g. 700M
+}
+
+// TwoPass checks if the mode needs an analysis pass before encoding
+func (r *RateControl) TwoPass() bool {
+	return r != nil && (r.Mode == RateTwoPass || r.Mode == RateSize)
+}
+
+// ParseBitrate parses a bitrate or size with an optional decimal k, M or G
+// suffix, e.g. 800k or 1.5G
+func ParseBitrate(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	multiplier := 1.0
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'k', 'K':
+			multiplier = 1e3
+		case 'm', 'M':
+			multiplier = 1e6
+		case 'g', 'G':
+			multiplier = 1e9
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("expected a positive number with an optional k, M or G suffix")
+	}
+	return int64(number * multiplier), nil
+}
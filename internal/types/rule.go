@@ -0,0 +1,29 @@
+package types
+
+import (
+	"sync"
+)
+
+// OutputRule describes one output produced for every source file
+type OutputRule struct {
+	Preset    string `json:"preset"`    // empty uses the file's assigned preset
+	OutputDir string `json:"outputDir"` // empty uses --output-dir
+}
+
+var OutputRulesMutex = &sync.Mutex{}
+var OutputRules []OutputRule // OutputRules fan each source out to multiple outputs, empty for a single output
+
+// GetOutputRules returns a copy of the configured output rules
+func GetOutputRules() []OutputRule {
+	OutputRulesMutex.Lock()
+	defer OutputRulesMutex.Unlock()
+	return append([]OutputRule{}, OutputRules...)
+}
+
+// SetOutputRules replaces the output rules and saves the preset config
+func SetOutputRules(rules []OutputRule) error {
+	OutputRulesMutex.Lock()
+	OutputRules = append([]OutputRule{}, rules...)
+	OutputRulesMutex.Unlock()
+	return ExportPresets()
+}
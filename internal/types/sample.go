@@ -0,0 +1,29 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSampleNotFound = errors.New("preview not found")
+
+// SampleRequest asks for a short preview encode of a source
+type SampleRequest struct {
+	Preset string    `json:"preset"` // defaults to the preset of the first output
+	Start  *Timecode `json:"start"`  // defaults to the trim in point, or the start of the source
+	Length Timecode  `json:"length"` // defaults to --preview-length
+}
+
+// Sample is a preview encode kept in a temporary location until it expires
+type Sample struct {
+	ID           string    `json:"id"`
+	FileID       string    `json:"fileId"`
+	Preset       string    `json:"preset"`
+	Start        Timecode  `json:"start"`
+	Length       Timecode  `json:"length"`
+	VideoEncoder string    `json:"videoEncoder,omitempty"`
+	AudioEncoder string    `json:"audioEncoder,omitempty"`
+	URL          string    `json:"url"`
+	Expires      time.Time `json:"expires"`
+	FilePath     string    `json:"-"`
+}
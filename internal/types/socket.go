@@ -7,6 +7,8 @@ const (
 	UpdateFile   MessageType = "update_file"
 	CreateFile   MessageType = "create_file"
 	DeleteFile   MessageType = "delete_file"
+	CommandError MessageType = "command_error"
+	UpdateConfig MessageType = "update_config"
 )
 
 type Message struct {
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+)
+
+type SelectMode string
+
+const (
+	SelectFirst     SelectMode = "first"     // the first stream of the type
+	SelectAll       SelectMode = "all"       // every stream of the type
+	SelectNone      SelectMode = "none"      // no stream of the type
+	SelectTracks    SelectMode = "tracks"    // the streams with the listed probe indices
+	SelectLanguages SelectMode = "languages" // the streams tagged with one of the listed languages
+)
+
+// StreamSelection picks the streams of one type from the source
+type StreamSelection struct {
+	Mode      SelectMode `json:"mode"`
+	Tracks    []int      `json:"tracks,omitempty"`    // stream indices as reported by the probe
+	Languages []string   `json:"languages,omitempty"` // ISO 639-2 codes, e.g. eng
+}
+
+// StreamMap declares which source streams are written to the output, it is
+// resolved against the probe of each source
+type StreamMap struct {
+	Video    *StreamSelection `json:"video,omitempty"`    // nil selects the first video stream
+	Audio    *StreamSelection `json:"audio,omitempty"`    // nil selects the first audio stream
+	Data     bool             `json:"data,omitempty"`     // copy data streams, dropped otherwise
+	Timecode bool             `json:"timecode,omitempty"` // keep the start timecode of the source
+}
+
+// validateStreams checks the selections of a stream map
+func validateStreams(p PresetBundle, errs FieldErrors) {
+	streams := p.Streams
+	if streams == nil {
+		return
+	}
+	if p.Packaging != nil && streams.Video != nil && streams.Video.Mode == SelectNone {
+		errs["streams.video"] = "packaged presets scale the ladder from a video stream"
+	}
+	if p.AudioOnly() && streams.Video != nil && streams.Video.Mode != SelectNone {
+		errs["streams.video"] = "audio-only presets can't select video streams"
+	}
+	validateSelection("streams.video", streams.Video, errs)
+	validateSelection("streams.audio", streams.Audio, errs)
+}
+
+func validateSelection(field string, selection *StreamSelection, errs FieldErrors) {
+	if selection == nil {
+		return
+	}
+	switch selection.Mode {
+	case SelectFirst, SelectAll, SelectNone:
+	case SelectTracks:
+		if len(selection.Tracks) == 0 {
+			errs[field+".tracks"] = "tracks mode requires stream indices"
+		} else if slices.Min(selection.Tracks) < 0 {
+			errs[field+".tracks"] = "stream indices must not be negative"
+		}
+	case SelectLanguages:
+		if len(selection.Languages) == 0 {
+			errs[field+".languages"] = "languages mode requires languages"
+		}
+	default:
+		errs[field+".mode"] = fmt.Sprintf("unknown selection mode %s, expected one of: first, all, none, tracks, languages", selection.Mode)
+	}
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+)
+
+type SubtitleMode string
+
+const (
+	SubtitleNone    SubtitleMode = "none"    // drop every subtitle stream
+	SubtitleCopy    SubtitleMode = "copy"    // pass the streams through to the output
+	SubtitleConvert SubtitleMode = "convert" // re-encode the streams into the output, e.g. to mov_text
+	SubtitleSidecar SubtitleMode = "sidecar" // write each stream to a file next to the output, e.g. as srt
+	SubtitleBurn    SubtitleMode = "burn"    // render the first selected stream into the video
+)
+
+// SubtitleExtensions maps the encoders usable for sidecar files to their extension
+var SubtitleExtensions = map[string]string{
+	"srt":    "srt",
+	"subrip": "srt",
+	"ass":    "ass",
+	"ssa":    "ass",
+	"webvtt": "vtt",
+}
+
+// SubtitlePreset declares how the subtitle streams of the source and the
+// subtitle files next to it are written
+type SubtitlePreset struct {
+	Mode   SubtitleMode     `json:"mode"`
+	Codec  string           `json:"codec,omitempty"`  // encoder of the convert and sidecar modes
+	Select *StreamSelection `json:"select,omitempty"` // nil selects every stream, burn-in uses the first selected
+}
+
+// SubtitleFile is a subtitle file found next to a source, e.g. movie.eng.srt
+// for movie.mp4
+type SubtitleFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"` // tag between the source name and the extension
+}
+
+// validateSubtitles checks the subtitle mode has the encoder and video it needs
+func validateSubtitles(p PresetBundle, errs FieldErrors) {
+	subtitles := p.Subtitles
+	if subtitles == nil {
+		return
+	}
+
+	switch subtitles.Mode {
+	case SubtitleNone, SubtitleCopy:
+		if subtitles.Codec != "" {
+			errs["subtitles.codec"] = fmt.Sprintf("%s mode doesn't use a codec", subtitles.Mode)
+		}
+	case SubtitleConvert, SubtitleSidecar:
+		if subtitles.Codec == "" {
+			errs["subtitles.codec"] = fmt.Sprintf("%s mode requires a codec", subtitles.Mode)
+		} else if _, ok := FindEncoder(subtitles.Codec, Subtitle); !ok {
+			errs["subtitles.codec"] = fmt.Sprintf("unknown encoder %s", subtitles.Codec)
+		} else if _, ok := SubtitleExtensions[subtitles.Codec]; !ok && subtitles.Mode == SubtitleSidecar {
+			errs["subtitles.codec"] = fmt.Sprintf("%s can't be written as a sidecar file, expected one of: srt, ass, webvtt", subtitles.Codec)
+		}
+	case SubtitleBurn:
+		if p.AudioOnly() {
+			errs["subtitles.mode"] = "audio-only presets can't burn in subtitles"
+		}
+		if subtitles.Codec != "" {
+			errs["subtitles.codec"] = "burn mode doesn't use a codec"
+		}
+	default:
+		errs["subtitles.mode"] = fmt.Sprintf("unknown subtitle mode %s, expected one of: none, copy, convert, sidecar, burn", subtitles.Mode)
+	}
+
+	if p.Packaging != nil && subtitles.Mode != SubtitleNone {
+		errs["subtitles"] = "packaged presets can't carry subtitles"
+	}
+	if subtitles.Select != nil && subtitles.Select.Mode == SelectNone {
+		errs["subtitles.select.mode"] = "use the none subtitle mode to drop subtitles"
+	}
+	validateSelection("subtitles.select", subtitles.Select, errs)
+}
+
+// bitmapSubtitleCodecs are subtitle formats stored as images, they can't be
+// converted to text formats or rendered by the subtitles filter
+var bitmapSubtitleCodecs = []string{"hdmv_pgs_subtitle", "dvd_subtitle", "dvb_subtitle", "xsub"}
+
+// IsBitmapSubtitle reports whether a subtitle codec stores its cues as images
+func IsBitmapSubtitle(codec string) bool {
+	return slices.Contains(bitmapSubtitleCodecs, codec)
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidTrim = errors.New("invalid trim range")
+
+// Timecode is a position in seconds, read from a number of seconds or a
+// HH:MM:SS.ms, MM:SS or seconds string
+type Timecode float64
+
+func (t *Timecode) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*t = Timecode(seconds)
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("timecode must be a number of seconds or HH:MM:SS.ms")
+	}
+	parsed, err := ParseTimecode(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// ParseTimecode parses HH:MM:SS.ms, MM:SS or a number of seconds
+func ParseTimecode(value string) (Timecode, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timecode %s, expected HH:MM:SS.ms", value)
+	}
+
+	seconds := 0.0
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 || (i > 0 && number >= 60) {
+			return 0, fmt.Errorf("invalid timecode %s, expected HH:MM:SS.ms", value)
+		}
+		seconds = seconds*60 + number
+	}
+	return Timecode(seconds), nil
+}
+
+// String formats the timecode as HH:MM:SS.mmm for ffmpeg
+func (t Timecode) String() string {
+	ms := int64(float64(t)*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// Trim limits a job to a section of the source, a zero out point runs to the end
+type Trim struct {
+	In  Timecode `json:"in"`
+	Out Timecode `json:"out,omitempty"`
+}
+
+// Length returns the duration of the trimmed range of a source, the full
+// duration is 0 if the source couldn't be probed
+func (t *Trim) Length(full float64) float64 {
+	if t == nil {
+		return full
+	}
+	out := float64(t.Out)
+	if out <= 0 || (full > 0 && out > full) {
+		out = full
+	}
+	return max(0, out-float64(t.In))
+}
+
+// Validate checks the range is ordered and starts within the source
+func (t *Trim) Validate(full float64) error {
+	switch {
+	case t.In < 0 || t.Out < 0:
+		return fmt.Errorf("%w: in and out points must not be negative", ErrInvalidTrim)
+	case t.Out > 0 && t.Out <= t.In:
+		return fmt.Errorf("%w: out point must be after the in point", ErrInvalidTrim)
+	case full > 0 && float64(t.In) >= full:
+		return fmt.Errorf("%w: in point is past the end of the source (%s)", ErrInvalidTrim, Timecode(full))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	opts "blockbuffer/internal/settings"
+)
+
+func TestMain(m *testing.M) {
+	// loading the presets at init writes a blank config next to the tests
+	if data, err := os.ReadFile(*opts.PresetConfigPath); err == nil && string(data) == `{"presets":[]}` {
+		os.Remove(*opts.PresetConfigPath)
+	}
+	os.Exit(m.Run())
+}
+
+func TestParseTimecode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Timecode
+		wantErr bool
+	}{
+		{"90", 90, false},
+		{"1.5", 1.5, false},
+		{"01:30", 90, false},
+		{"01:02:03.250", 3723.25, false},
+		{" 00:00:10 ", 10, false},
+		{"00:60:00", 0, true},
+		{"00:00:60", 0, true},
+		{"-5", 0, true},
+		{"1:2:3:4", 0, true},
+		{"1:ab", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimecode(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimecode(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimecode(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTimecodeString(t *testing.T) {
+	tests := []struct {
+		value Timecode
+		want  string
+	}{
+		{0, "00:00:00.000"},
+		{3723.25, "01:02:03.250"},
+		{59.9996, "00:01:00.000"},
+	}
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("Timecode(%v).String() = %q, want %q", float64(tt.value), got, tt.want)
+		}
+	}
+}
+
+func TestTrimValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		trim    Trim
+		full    float64
+		wantErr bool
+	}{
+		{"in point only", Trim{In: 10}, 60, false},
+		{"range", Trim{In: 10, Out: 20}, 60, false},
+		{"out past the end", Trim{In: 10, Out: 90}, 60, false},
+		{"unknown duration", Trim{In: 100}, 0, false},
+		{"negative in", Trim{In: -1}, 60, true},
+		{"negative out", Trim{Out: -1}, 60, true},
+		{"out before in", Trim{In: 20, Out: 10}, 60, true},
+		{"empty range", Trim{In: 20, Out: 20}, 60, true},
+		{"in past the end", Trim{In: 60}, 60, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.trim.Validate(tt.full)
+			if tt.wantErr && !errors.Is(err, ErrInvalidTrim) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidTrim)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+		})
+	}
+}
+
+func TestTrimLength(t *testing.T) {
+	tests := []struct {
+		name string
+		trim *Trim
+		full float64
+		want float64
+	}{
+		{"untrimmed", nil, 60, 60},
+		{"in point only", &Trim{In: 10}, 60, 50},
+		{"range", &Trim{In: 10, Out: 20}, 60, 10},
+		{"out past the end", &Trim{In: 10, Out: 90}, 60, 50},
+		{"range of an unprobed source", &Trim{In: 10, Out: 20}, 0, 10},
+		{"in point of an unprobed source", &Trim{In: 10}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.trim.Length(tt.full); got != tt.want {
+				t.Errorf("Length(%v) = %v, want %v", tt.full, got, tt.want)
+			}
+		})
+	}
+}
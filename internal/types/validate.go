@@ -0,0 +1,255 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// FieldErrors maps a preset field (e.g. video.codec) to the reason it was rejected
+type FieldErrors map[string]string
+
+// CopyCodec is the ffmpeg codec name used to pass streams through without re-encoding
+const CopyCodec = "copy"
+
+var numericValue = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?[kKMGT]?i?B?$`)
+
+// Validate checks the preset against the encoders detected in the local ffmpeg
+// and returns an empty map if the preset is usable
+func (p PresetBundle) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if strings.TrimSpace(p.Name) == "" {
+		errs["name"] = "name is required"
+	}
+	// packaged presets write playlists and segments instead of a single file
+	if p.Packaging == nil && strings.TrimSpace(strings.TrimPrefix(p.Extension, ".")) == "" {
+		errs["extension"] = "extension is required"
+	}
+
+	if p.AudioOnly() {
+		validateAudioOnly(p, errs)
+	} else if encoder, ok := validateCodec("video.codec", p.VideoPreset.Codec, Video, errs); ok {
+		if p.VideoPreset.Format != "" && len(encoder.Formats) > 0 && !slices.Contains(encoder.Formats, p.VideoPreset.Format) {
+			errs["video.format"] = fmt.Sprintf("%s does not support pixel format %s", encoder.Name, p.VideoPreset.Format)
+		}
+		validateOptions("video", encoder, p.VideoPreset.Options, errs)
+	}
+	validateScale(p.VideoPreset.Scale, errs)
+	validateFilters("video", p.VideoPreset.Filters, VideoStream, errs)
+	validateFilters("audio", p.AudioPreset.Filters, AudioStream, errs)
+	if len(p.VideoPreset.Filters) > 0 && slices.Contains(p.VideoPreset.Codec, CopyCodec) {
+		errs["video.filters"] = "filters can't be applied to copied streams"
+	}
+	if p.VideoPreset.AutoCrop && slices.Contains(p.VideoPreset.Codec, CopyCodec) {
+		errs["video.autoCrop"] = "copied streams can't be cropped"
+	}
+	if len(p.AudioPreset.Filters) > 0 && slices.Contains(p.AudioPreset.Codec, CopyCodec) {
+		errs["audio.filters"] = "filters can't be applied to copied streams"
+	}
+	validateRate(p.VideoPreset.Rate, errs)
+	validatePackaging(p, errs)
+	validateStreams(p, errs)
+	validateSubtitles(p, errs)
+
+	if encoder, ok := validateCodec("audio.codec", p.AudioPreset.Codec, Audio, errs); ok {
+		rate := p.AudioPreset.SampleRate
+		if rate != nil && *rate != "" && len(encoder.SampleRates) > 0 && !slices.Contains(encoder.SampleRates, *rate) {
+			errs["audio.sampleRate"] = fmt.Sprintf("%s does not support sample rate %s", encoder.Name, *rate)
+		}
+		if format := p.AudioPreset.Format; format != "" && len(encoder.Formats) > 0 && !slices.Contains(encoder.Formats, format) {
+			errs["audio.format"] = fmt.Sprintf("%s does not support sample format %s, expected one of: %s", encoder.Name, format, strings.Join(encoder.Formats, ", "))
+		}
+		validateOptions("audio", encoder, p.AudioPreset.Options, errs)
+	}
+	if p.AudioPreset.Channels < 0 {
+		errs["audio.channels"] = "channels must not be negative"
+	}
+	if p.AudioPreset.Bitrate != "" {
+		if _, err := ParseBitrate(p.AudioPreset.Bitrate); err != nil {
+			errs["audio.bitrate"] = err.Error()
+		}
+	}
+
+	return errs
+}
+
+// validateAudioOnly checks a preset without a video codec has an audio codec
+// and no video settings
+func validateAudioOnly(p PresetBundle, errs FieldErrors) {
+	if len(p.AudioPreset.Codec) == 0 {
+		errs["video.codec"] = "a video or audio codec is required"
+		errs["audio.codec"] = "a video or audio codec is required"
+	}
+	video := p.VideoPreset
+	if video.Format != "" || video.Scale != nil || video.Rate != nil || len(video.Filters) > 0 || video.AutoCrop || (video.Options != nil && len(*video.Options) > 0) {
+		errs["video"] = "audio-only presets can't have video settings"
+	}
+	if p.Packaging != nil {
+		errs["packaging"] = "audio-only presets can't be packaged"
+	}
+}
+
+// validateCodec checks every candidate is a known encoder and that one of
+// them is usable, returning the encoder the preset will run with
+func validateCodec(field string, codecs CodecList, encType EncoderType, errs FieldErrors) (Encoder, bool) {
+	for _, name := range codecs {
+		if name == CopyCodec {
+			continue
+		}
+		if _, ok := FindEncoder(name, encType); !ok {
+			errs[field] = fmt.Sprintf("unknown encoder %s", name)
+			return Encoder{}, false
+		}
+	}
+	if len(codecs) == 0 {
+		return Encoder{}, false
+	}
+
+	name, ok := codecs.Resolve(encType)
+	if !ok {
+		errs[field] = fmt.Sprintf("none of the encoders can be used on this machine: %s", codecs)
+		return Encoder{}, false
+	}
+	if name == CopyCodec {
+		return Encoder{}, false
+	}
+	return FindEncoder(name, encType)
+}
+
+// validateScale checks the scale rule has the dimensions its mode requires
+func validateScale(rule *ScaleRule, errs FieldErrors) {
+	if rule == nil {
+		return
+	}
+
+	switch rule.Mode {
+	case ScaleKeep:
+	case ScaleMax:
+		if rule.Width <= 0 && rule.Height <= 0 {
+			errs["video.scale"] = "max mode requires a width or height"
+		}
+	case ScaleFit, ScaleFill, ScalePad:
+		if rule.Width <= 0 || rule.Height <= 0 {
+			errs["video.scale"] = fmt.Sprintf("%s mode requires a width and height", rule.Mode)
+		}
+	default:
+		errs["video.scale.mode"] = fmt.Sprintf("unknown scale mode %s, expected one of: keep, max, fit, fill, pad", rule.Mode)
+	}
+
+	if rule.Width < 0 || rule.Height < 0 || rule.MinWidth < 0 || rule.MinHeight < 0 {
+		errs["video.scale"] = "dimensions must not be negative"
+	}
+	if rule.Rounding != 0 && (rule.Rounding < 2 || rule.Rounding&(rule.Rounding-1) != 0) {
+		errs["video.scale.rounding"] = "rounding must be a power of two, e.g. 2 or 16"
+	}
+}
+
+// validateRate checks the rate control has the values its mode requires
+func validateRate(rate *RateControl, errs FieldErrors) {
+	if rate == nil {
+		return
+	}
+
+	required := map[string]string{}
+	switch rate.Mode {
+	case RateQuality:
+		if rate.Quality == nil {
+			errs["video.rateControl.quality"] = "quality mode requires a quality value"
+		} else if *rate.Quality < 0 {
+			errs["video.rateControl.quality"] = "quality must not be negative"
+		}
+	case RateCBR, RateTwoPass:
+		required["bitrate"] = rate.Bitrate
+	case RateVBR:
+		required["bitrate"] = rate.Bitrate
+		required["maxRate"] = rate.MaxRate
+	case RateSize:
+		required["targetSize"] = rate.TargetSize
+	default:
+		errs["video.rateControl.mode"] = fmt.Sprintf("unknown rate control mode %s, expected one of: quality, cbr, vbr, 2pass, size", rate.Mode)
+	}
+	if rate.BufSize != "" {
+		required["bufSize"] = rate.BufSize
+	}
+
+	for field, value := range required {
+		if value == "" {
+			errs["video.rateControl."+field] = fmt.Sprintf("%s mode requires %s", rate.Mode, field)
+		} else if _, err := ParseBitrate(value); err != nil {
+			errs["video.rateControl."+field] = err.Error()
+		}
+	}
+}
+
+// validateOptions checks option names exist on the encoder and that values match the option type,
+// generic codec options aren't listed by encoders and are passed through unchecked
+func validateOptions(prefix string, encoder Encoder, options *Options, errs FieldErrors) {
+	if options == nil {
+		return
+	}
+
+	for _, opt := range *options {
+		field := prefix + ".options." + opt.Name
+		idx := slices.IndexFunc(encoder.Options, func(o AVOption) bool { return o.Name == opt.Name })
+		if idx < 0 {
+			if !IsGenericOption(opt.Name) {
+				errs[field] = fmt.Sprintf("%s has no option %s", encoder.Name, opt.Name)
+			}
+			continue
+		}
+
+		if reason := checkOptionValue(encoder.Options[idx], opt.Value); reason != "" {
+			errs[field] = reason
+		}
+	}
+}
+
+// checkOptionValue returns the reason a value is invalid for the option, empty if valid
+func checkOptionValue(option AVOption, value string) string {
+	// flags are combined with + and -, each flag must be a known enum value
+	if option.Type == "flags" {
+		for _, flag := range strings.FieldsFunc(value, func(r rune) bool { return r == '+' || r == '-' }) {
+			if !hasEnumValue(option, flag) {
+				return fmt.Sprintf("unknown flag %s, expected one of: %s", flag, enumNames(option))
+			}
+		}
+		return ""
+	}
+
+	// enum values may be given by name or by their numeric id
+	if len(option.Options) > 0 && hasEnumValue(option, value) {
+		return ""
+	}
+
+	switch option.Type {
+	case "int", "float", "double":
+		if !numericValue.MatchString(value) {
+			if len(option.Options) > 0 {
+				return fmt.Sprintf("expected one of: %s", enumNames(option))
+			}
+			return fmt.Sprintf("expected a number, got %s", value)
+		}
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "true", "false", "1", "0", "-1", "auto":
+		default:
+			return fmt.Sprintf("expected a boolean, got %s", value)
+		}
+	}
+	return ""
+}
+
+func hasEnumValue(option AVOption, value string) bool {
+	return slices.ContainsFunc(option.Options, func(e AVOptionEnum) bool {
+		return e.Option == value || e.ID == value
+	})
+}
+
+func enumNames(option AVOption) string {
+	var names []string
+	for _, e := range option.Options {
+		names = append(names, e.Option)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// testEncoders stands in for the encoders detected in the local ffmpeg
+var testEncoders = []Encoder{
+	{Type: Video, Name: "libx264", Formats: []string{"yuv420p", "yuv422p"}, Options: []AVOption{
+		{Name: "preset", Type: "string"},
+		{Name: "crf", Type: "float"},
+		{Name: "tune", Type: "int", Options: []AVOptionEnum{{Option: "film", ID: "1"}, {Option: "animation", ID: "2"}}},
+		{Name: "x264opts", Type: "flags", Options: []AVOptionEnum{{Option: "fast"}, {Option: "slow"}}},
+		{Name: "a53cc", Type: "boolean"},
+	}},
+	{Type: Video, Name: "h264_nvenc", Unavailable: "no device"},
+	{Type: Audio, Name: "aac", Formats: []string{"fltp"}, SampleRates: []string{"44100", "48000"}},
+	{Type: Audio, Name: "pcm_s24le", Formats: []string{"s32"}},
+}
+
+func validPreset() PresetBundle {
+	return PresetBundle{
+		Name:        "Test",
+		Extension:   "mp4",
+		VideoPreset: VideoPreset{Codec: CodecList{"libx264"}, Format: "yuv420p"},
+		AudioPreset: AudioPreset{Codec: CodecList{"aac"}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	SetEncoders(testEncoders)
+	t.Cleanup(func() { SetEncoders(nil) })
+
+	rate := "96000"
+	quality := -1
+	tests := []struct {
+		name   string
+		modify func(p *PresetBundle)
+		fields []string // the fields rejected, none for a usable preset
+	}{
+		{"valid", func(p *PresetBundle) {}, nil},
+		{"missing name", func(p *PresetBundle) { p.Name = " " }, []string{"name"}},
+		{"missing extension", func(p *PresetBundle) { p.Extension = "." }, []string{"extension"}},
+		{"unknown video encoder", func(p *PresetBundle) { p.VideoPreset.Codec = CodecList{"libx265"} }, []string{"video.codec"}},
+		{"no usable encoder", func(p *PresetBundle) { p.VideoPreset.Codec = CodecList{"h264_nvenc"} }, []string{"video.codec"}},
+		{"fallback encoder", func(p *PresetBundle) { p.VideoPreset.Codec = CodecList{"h264_nvenc", "libx264"} }, nil},
+		{"unsupported pixel format", func(p *PresetBundle) { p.VideoPreset.Format = "yuv444p" }, []string{"video.format"}},
+		{"audio only", func(p *PresetBundle) { p.VideoPreset = VideoPreset{}; p.Extension = "m4a" }, nil},
+		{"audio only with video settings", func(p *PresetBundle) { p.VideoPreset = VideoPreset{AutoCrop: true} }, []string{"video"}},
+		{"no codecs", func(p *PresetBundle) { p.VideoPreset = VideoPreset{}; p.AudioPreset = AudioPreset{} }, []string{"video.codec", "audio.codec"}},
+		{"copied video with filters", func(p *PresetBundle) {
+			p.VideoPreset.Codec = CodecList{CopyCodec}
+			p.VideoPreset.Format = ""
+			p.VideoPreset.Filters = []Filter{{Type: FilterDeinterlace}}
+		}, []string{"video.filters"}},
+		{"copied video with auto-crop", func(p *PresetBundle) {
+			p.VideoPreset.Codec = CodecList{CopyCodec}
+			p.VideoPreset.AutoCrop = true
+		}, []string{"video.autoCrop"}},
+		{"scale without size", func(p *PresetBundle) { p.VideoPreset.Scale = &ScaleRule{Mode: ScaleFit, Width: 1280} }, []string{"video.scale"}},
+		{"unknown scale mode", func(p *PresetBundle) { p.VideoPreset.Scale = &ScaleRule{Mode: "stretch"} }, []string{"video.scale.mode"}},
+		{"negative quality", func(p *PresetBundle) {
+			p.VideoPreset.Rate = &RateControl{Mode: RateQuality, Quality: &quality}
+		}, []string{"video.rateControl.quality"}},
+		{"vbr without peak", func(p *PresetBundle) {
+			p.VideoPreset.Rate = &RateControl{Mode: RateVBR, Bitrate: "5M"}
+		}, []string{"video.rateControl.maxRate"}},
+		{"invalid bitrate", func(p *PresetBundle) {
+			p.VideoPreset.Rate = &RateControl{Mode: RateCBR, Bitrate: "fast"}
+		}, []string{"video.rateControl.bitrate"}},
+		{"unsupported sample rate", func(p *PresetBundle) { p.AudioPreset.SampleRate = &rate }, []string{"audio.sampleRate"}},
+		{"unsupported sample format", func(p *PresetBundle) { p.AudioPreset.Format = "s16" }, []string{"audio.format"}},
+		{"negative channels", func(p *PresetBundle) { p.AudioPreset.Channels = -1 }, []string{"audio.channels"}},
+		{"packaged with a stream map", func(p *PresetBundle) {
+			p.Packaging = &Packaging{Format: PackageHLS}
+			p.Streams = &StreamMap{Audio: &StreamSelection{Mode: SelectLanguages, Languages: []string{"fra"}}}
+		}, nil},
+		{"packaged without video", func(p *PresetBundle) {
+			p.Packaging = &Packaging{Format: PackageHLS}
+			p.Streams = &StreamMap{Video: &StreamSelection{Mode: SelectNone}}
+		}, []string{"streams.video"}},
+		{"invalid audio bitrate", func(p *PresetBundle) { p.AudioPreset.Bitrate = "loud" }, []string{"audio.bitrate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset := validPreset()
+			tt.modify(&preset)
+			errs := preset.Validate()
+			fields := slices.Sorted(maps.Keys(errs))
+			want := slices.Sorted(slices.Values(tt.fields))
+			if !slices.Equal(fields, want) {
+				t.Errorf("rejected fields %v, want %v: %v", fields, want, errs)
+			}
+		})
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	SetEncoders(testEncoders)
+	t.Cleanup(func() { SetEncoders(nil) })
+
+	tests := []struct {
+		name    string
+		option  string
+		value   string
+		wantErr bool
+	}{
+		{"string", "preset", "slow", false},
+		{"number", "crf", "18.5", false},
+		{"not a number", "crf", "high", true},
+		{"enum by name", "tune", "film", false},
+		{"enum by id", "tune", "2", false},
+		{"unknown enum", "tune", "grain", true},
+		{"flags", "x264opts", "+fast-slow", false},
+		{"unknown flag", "x264opts", "+turbo", true},
+		{"boolean", "a53cc", "false", false},
+		{"not a boolean", "a53cc", "maybe", true},
+		{"generic option", "g", "48", false},
+		{"unknown option", "gop", "48", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset := validPreset()
+			preset.VideoPreset.Options = &Options{{Name: tt.option, Value: tt.value}}
+			errs := preset.Validate()
+			_, rejected := errs["video.options."+tt.option]
+			if rejected != tt.wantErr || len(errs) > 1 {
+				t.Errorf("got errors %v, want rejected %v", errs, tt.wantErr)
+			}
+		})
+	}
+}